@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/sammyhass/web-ide/server/db"
+	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/storage"
+	"github.com/sammyhass/web-ide/server/wasm"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the server can run",
+	Long:  "Check the environment variables, database, storage and compilers the server needs, exiting with an error if any are broken",
+	Run: func(cmd *cobra.Command, args []string) {
+		healthy := true
+
+		check := func(name string, err error) {
+			if err != nil {
+				color.Red("✗ %s: %v", name, err)
+				healthy = false
+				return
+			}
+
+			color.Green("✓ %s", name)
+		}
+
+		missing := env.Check()
+		check("environment", checkEnv(missing))
+		configureToolchains()
+
+		if len(missing) == 0 {
+			check("database", checkDatabase())
+			check("storage", storage.Check())
+		} else {
+			color.Yellow("- skipping the database and storage until the environment is fixed")
+		}
+
+		for _, tc := range wasm.Toolchains() {
+			if tc.Available {
+				color.Green("✓ %s compiler: %s", tc.Language, describeToolchain(tc))
+			} else {
+				// a missing toolchain only stops its language being compiled so it isn't treated as broken
+				color.Yellow("! %s compiler: %s; %s", tc.Language, tc.Error, describeToolchain(tc))
+			}
+		}
+
+		check("compiler isolation", checkIsolation())
+
+		if !healthy {
+			os.Exit(1)
+		}
+	},
+}
+
+// checkEnv makes sure each required environment variable is set and those holding durations can be parsed
+func checkEnv(missing []env.EnvKey) error {
+	if len(missing) > 0 {
+		names := make([]string, len(missing))
+		for i, key := range missing {
+			names[i] = key.String()
+		}
+
+		return fmt.Errorf("missing %s", strings.Join(names, ", "))
+	}
+
+	for _, key := range []env.EnvKey{env.OPT_GC_INTERVAL, env.OPT_COMPILE_TIMEOUT} {
+		if v := env.Get(key); v != "" {
+			if _, err := time.ParseDuration(v); err != nil {
+				return fmt.Errorf("invalid %s: %v", key, err)
+			}
+		}
+	}
+
+	if v := env.Get(env.OPT_SANDBOX_REQUIRED); v != "" {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid %s: %s", env.OPT_SANDBOX_REQUIRED, v)
+		}
+	}
+
+	return nil
+}
+
+/*
+checkIsolation makes sure compilers are isolated from the network and the rest of the host's processes, compilers run
+without isolation are a failure even though the server only refuses to run them when OPT_SANDBOX_REQUIRED is set
+*/
+func checkIsolation() error {
+	if !wasm.Isolated() {
+		return errors.New("compilers run without isolation, unprivileged user namespaces are unavailable")
+	}
+
+	return nil
+}
+
+// checkDatabase makes sure the database can be reached and has been migrated
+func checkDatabase() error {
+	conn, err := db.Open()
+	if err != nil {
+		return err
+	}
+
+	sqlDb, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDb.Close()
+
+	if err := sqlDb.Ping(); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, table := range model.Tables() {
+		if conn.Migrator().HasTable(table) {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: conn}
+		if err := stmt.Parse(table); err != nil {
+			return err
+		}
+		missing = append(missing, stmt.Schema.Table)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing tables %s, run migrate", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+/*
+describeToolchain lists the installed versions of the tools a language is compiled with, marking the version new
+projects are pinned to, or why they can't be used
+*/
+func describeToolchain(tc wasm.Toolchain) string {
+	tools := make([]string, len(tc.Tools))
+	for i, tool := range tc.Tools {
+		switch {
+		case !tool.Available:
+			tools[i] = tool.Error
+		case tool.Version != "":
+			tools[i] = fmt.Sprintf("%s %s", tool.Name, tool.Version)
+		default:
+			// only the first line of a version is shown, some tools describe their dependencies on the lines after
+			tools[i] = strings.SplitN(tool.Description, "\n", 2)[0]
+		}
+
+		if tool.Default {
+			tools[i] += " (default)"
+		}
+	}
+
+	return strings.Join(tools, "; ")
+}
+
+// reportToolchains logs which languages can be compiled, projects in the others are reported as unavailable
+func reportToolchains() {
+	for _, tc := range wasm.Toolchains() {
+		if tc.Available {
+			log.Printf("[compile] %s: %s", tc.Language, describeToolchain(tc))
+		} else {
+			log.Printf("[compile] %s; %s", tc.Error, describeToolchain(tc))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/sammyhass/web-ide/server/db"
+	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/projects"
+	"github.com/sammyhass/web-ide/server/storage"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().Bool("dry-run", false, "Report what would be removed without removing anything")
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove orphaned project files from storage",
+	Long:  "Remove project sources and builds which no longer belong to a project, soft deleted projects and unreferenced blobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		env.InitEnv()
+
+		db.Connect()
+		defer db.Close()
+
+		storage.Init()
+
+		if dryRun {
+			color.Yellow("Dry run, nothing will be removed")
+		}
+
+		report, err := projects.NewService().CollectGarbage(dryRun)
+		if err != nil {
+			color.Red("Garbage collection failed: %v", err)
+			// os.Exit skips the deferred close
+			db.Close()
+			os.Exit(1)
+		}
+
+		for _, dir := range report.OrphanedDirs {
+			color.White("orphaned  %s", dir)
+		}
+
+		for _, id := range report.PurgedProjects {
+			color.White("deleted   %s", id)
+		}
+
+		color.Green(
+			"%d orphaned directories (%d files), %d deleted projects, %d unreferenced blobs",
+			len(report.OrphanedDirs),
+			report.OrphanedFiles,
+			len(report.PurgedProjects),
+			report.ReclaimedBlobs,
+		)
+	},
+}
@@ -1,11 +1,18 @@
 package cmd
 
 import (
+	"log"
+	"strconv"
+	"time"
+
 	"github.com/fatih/color"
 	"github.com/sammyhass/web-ide/server/db"
 	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/projects"
 	"github.com/sammyhass/web-ide/server/router"
-	"github.com/sammyhass/web-ide/server/s3"
+	"github.com/sammyhass/web-ide/server/storage"
+	"github.com/sammyhass/web-ide/server/wasm"
 	"github.com/spf13/cobra"
 )
 
@@ -33,7 +40,46 @@ func startServer(port string) {
 	db.Connect()
 	defer db.Close()
 
-	s3.InitSession()
+	storage.Init()
+
+	if interval := env.GetOr(env.OPT_GC_INTERVAL, ""); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("[gc] Invalid %s: %v", env.OPT_GC_INTERVAL, err)
+		}
+
+		projects.StartGC(d)
+	}
+
+	limits := wasm.DefaultLimits
+	if timeout := env.GetOr(env.OPT_COMPILE_TIMEOUT, ""); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("[compile] Invalid %s: %v", env.OPT_COMPILE_TIMEOUT, err)
+		}
+
+		limits.Timeout = d
+		limits.CPUTime = d
+	}
+	limits.Memory = int64(envCount(env.OPT_COMPILE_MAX_MEMORY, int(limits.Memory)))
+
+	wasm.SetLimits(limits)
+	wasm.SetSandboxRequired(envBool(env.OPT_SANDBOX_REQUIRED))
+	wasm.SetConcurrency(envCount(env.OPT_COMPILE_CONCURRENCY, wasm.DefaultConcurrency))
+	configureToolchains()
+
+	workers := envCount(env.OPT_COMPILE_WORKERS, 4)
+	if workers > 0 {
+		if envBool(env.OPT_SANDBOX_REQUIRED) && !wasm.Isolated() {
+			log.Fatalf(
+				"[compile] %s is set but compilers can't be isolated, unprivileged user namespaces are unavailable",
+				env.OPT_SANDBOX_REQUIRED,
+			)
+		}
+
+		reportToolchains()
+	}
+	projects.StartCompileWorkers(workers)
 
 	if port != "" {
 		env.Set(env.PORT, port)
@@ -41,3 +87,40 @@ func startServer(port string) {
 
 	router.Run(env.Get(env.PORT))
 }
+
+// configureToolchains sets where versions of the compilers are installed and the versions new projects are pinned to
+func configureToolchains() {
+	wasm.SetToolchainsDir(env.Get(env.OPT_TOOLCHAINS_DIR))
+	wasm.SetDefaultVersion(model.LanguageGo, env.Get(env.OPT_TINYGO_VERSION))
+	wasm.SetDefaultVersion(model.LanguageAssemblyScript, env.Get(env.OPT_ASC_VERSION))
+}
+
+// envBool reads a switch from the environment, which is off unless it is set
+func envBool(key env.EnvKey) bool {
+	v := env.GetOr(key, "")
+	if v == "" {
+		return false
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("[compile] Invalid %s: %s", key, v)
+	}
+
+	return b
+}
+
+// envCount reads a count or size from the environment, falling back to a default when it isn't set
+func envCount(key env.EnvKey, fallback int) int {
+	v := env.GetOr(key, "")
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("[compile] Invalid %s: %s", key, v)
+	}
+
+	return n
+}
@@ -0,0 +1,131 @@
+/*
+Package compress decides which files are worth compressing in storage and converts them to and from their stored
+encoding. Compressed files are stored with a Content-Encoding so that browsers decompress downloads themselves.
+*/
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+)
+
+// Gzip is the Content-Encoding of files compressed with gzip
+const Gzip = "gzip"
+
+// contentTypes maps the extensions of build outputs missing from the mime package to their content types
+var contentTypes = map[string]string{
+	".wasm": "application/wasm",
+	".wat":  "text/plain; charset=utf-8",
+}
+
+// ContentType returns the content type of a file from its extension, or an empty string when it isn't known
+func ContentType(fileName string) string {
+	ext := path.Ext(fileName)
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+
+	return mime.TypeByExtension(ext)
+}
+
+// Compressible reports whether files of a content type are worth compressing, formats which are already compressed
+// such as images gain nothing
+func Compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+
+	switch mediaType {
+	case "application/wasm",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"image/svg+xml":
+		return true
+	}
+
+	return false
+}
+
+/*
+Encode compresses the content of r with gzip, returning the compressed content and the size of the original
+*/
+func Encode(r io.Reader) ([]byte, int64, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	size, err := io.Copy(zw, r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, 0, err
+	}
+
+	return buf.Bytes(), size, nil
+}
+
+/*
+Decode returns a reader of the original content of a file stored with the given encoding, files stored without an
+encoding are returned as they are
+*/
+func Decode(encoding string, r io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "":
+		return r, nil
+	case Gzip:
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+	}
+}
+
+// decodedReader reads decoded content, closing both the decoder and the stored content it reads from
+type decodedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decodedReader) Close() error {
+	var firstErr error
+	for _, c := range d.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+/*
+DecodeCloser is Decode for content which must be closed once it has been read, closing the returned reader closes rc.
+rc is closed if the content can't be decoded.
+*/
+func DecodeCloser(encoding string, rc io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "":
+		return rc, nil
+	case Gzip:
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+
+		return &decodedReader{Reader: zr, closers: []io.Closer{zr, rc}}, nil
+	default:
+		rc.Close()
+		return nil, fmt.Errorf("unsupported content encoding %s", encoding)
+	}
+}
@@ -0,0 +1,101 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncodeAndDecode(t *testing.T) {
+	wat := strings.Repeat("(func $main (result i32)\n  i32.const 42)\n", 100)
+
+	encoded, size, err := Encode(strings.NewReader(wat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != int64(len(wat)) {
+		t.Errorf("Expected the original size to be %d, got %d", len(wat), size)
+	}
+
+	if len(encoded) >= len(wat) {
+		t.Errorf("Expected repetitive text to compress, got %d bytes from %d", len(encoded), len(wat))
+	}
+
+	r, err := Decode(Gzip, bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(decoded) != wat {
+		t.Error("Expected decoding to return the original content")
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     bool
+	}{
+		{"main.wasm", true},
+		{"main.wat", true},
+		{"index.html", true},
+		{"data.json", true},
+		{"sprite.png", false},
+		{"unknown", false},
+	}
+
+	for _, tt := range tests {
+		if got := Compressible(ContentType(tt.fileName)); got != tt.want {
+			t.Errorf("Expected Compressible(%s) to be %v, got %v", tt.fileName, tt.want, got)
+		}
+	}
+}
+
+// closeRecorder records whether it has been closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDecodeCloser(t *testing.T) {
+	encoded, _, err := Encode(strings.NewReader("package main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := &closeRecorder{Reader: bytes.NewReader(encoded)}
+	r, err := DecodeCloser(Gzip, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(decoded) != "package main" {
+		t.Errorf("Expected 'package main', got '%s'", decoded)
+	}
+
+	if err := r.Close(); err != nil || !stored.closed {
+		t.Error("Expected closing the decoded reader to close the stored content")
+	}
+
+	invalid := &closeRecorder{Reader: strings.NewReader("not gzip")}
+	if _, err := DecodeCloser(Gzip, invalid); err == nil || !invalid.closed {
+		t.Error("Expected content which can't be decoded to be closed along with an error")
+	}
+}
@@ -13,7 +13,17 @@ import (
 var db *gorm.DB
 
 func Connect() {
+	conn, err := Open()
+	if err != nil {
+		log.Fatalf("[db] Error connecting to database: %v", err)
+	}
 
+	db = conn
+	log.Println("[db] Connected to database")
+}
+
+// Open opens a new connection to the database described in the environment
+func Open() (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s",
 		env.Get(env.POSTGRES_HOST),
@@ -24,20 +34,18 @@ func Connect() {
 	)
 
 	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-
 	if err != nil {
-		log.Fatalf("[db] Error connecting to database: %v", err)
+		return nil, err
 	}
 
 	sqlDb, err := conn.DB()
 	if err != nil {
-		log.Fatalf("[db] Error getting sql db: %v", err)
+		return nil, fmt.Errorf("error getting sql db: %w", err)
 	}
 
 	sqlDb.SetConnMaxLifetime(time.Minute * 4)
 
-	db = conn
-	log.Println("[db] Connected to database")
+	return conn, nil
 }
 
 func GetConnection() *gorm.DB {
@@ -0,0 +1,240 @@
+/*
+Package diff produces unified diffs between two versions of a text file
+*/
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change
+const DefaultContext = 3
+
+// maxEditDistance bounds the work done to find a minimal diff, files which differ by more lines than this are shown
+// as being entirely replaced
+const maxEditDistance = 2000
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	kind opKind
+	text string
+	aPos int // aPos is the number of lines of a before this edit
+	bPos int // bPos is the number of lines of b before this edit
+}
+
+// splitLines splits text into lines, each line keeps its trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+/*
+myers finds the shortest sequence of edits turning a into b using Myers' O(ND) algorithm, falling back to replacing
+every line when the files differ by more than maxEditDistance lines
+*/
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit > maxEditDistance {
+		limit = maxEditDistance
+	}
+
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v[-d-1..d+1] as it was before round d
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+
+	return replaceAll(a, b)
+}
+
+func backtrack(trace [][]int, a, b []string) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{kind: opEqual, text: a[x-1], aPos: x - 1, bPos: y - 1})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{kind: opInsert, text: b[y-1], aPos: x, bPos: y - 1})
+			} else {
+				edits = append(edits, edit{kind: opDelete, text: a[x-1], aPos: x - 1, bPos: y})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
+
+func replaceAll(a, b []string) []edit {
+	edits := make([]edit, 0, len(a)+len(b))
+	for i, l := range a {
+		edits = append(edits, edit{kind: opDelete, text: l, aPos: i, bPos: 0})
+	}
+	for j, l := range b {
+		edits = append(edits, edit{kind: opInsert, text: l, aPos: len(a), bPos: j})
+	}
+
+	return edits
+}
+
+/*
+Unified returns a unified diff turning a into b, aName and bName are used in the file header lines. An empty string is
+returned when a and b are the same.
+*/
+func Unified(aName, bName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+
+	edits := myers(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+
+	for i := 0; i < len(edits); {
+		if edits[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		// extend the hunk until there is a run of unchanged lines long enough to separate it from the next change
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != opEqual {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+
+		stop := end + context + 1
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+
+		writeHunk(&out, edits[start:stop])
+		i = stop
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, hunk []edit) {
+	aCount, bCount := 0, 0
+	for _, e := range hunk {
+		if e.kind != opInsert {
+			aCount++
+		}
+		if e.kind != opDelete {
+			bCount++
+		}
+	}
+
+	aStart, bStart := hunk[0].aPos, hunk[0].bPos
+	if aCount > 0 {
+		aStart++
+	}
+	if bCount > 0 {
+		bStart++
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+
+	for _, e := range hunk {
+		prefix := " "
+		switch e.kind {
+		case opDelete:
+			prefix = "-"
+		case opInsert:
+			prefix = "+"
+		}
+
+		out.WriteString(prefix)
+		out.WriteString(e.text)
+		if !strings.HasSuffix(e.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
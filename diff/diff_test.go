@@ -0,0 +1,75 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified_Identical(t *testing.T) {
+	if d := Unified("a/main.go", "b/main.go", "package main\n", "package main\n", DefaultContext); d != "" {
+		t.Errorf("Expected no diff for identical files, got %q", d)
+	}
+}
+
+func TestUnified_ChangedLine(t *testing.T) {
+	a := "package main\n\nfunc main() {\n\tprintln(\"a\")\n}\n"
+	b := "package main\n\nfunc main() {\n\tprintln(\"b\")\n}\n"
+
+	want := `--- a/main.go
++++ b/main.go
+@@ -1,5 +1,5 @@
+ package main
+ 
+ func main() {
+-	println("a")
++	println("b")
+ }
+`
+
+	if got := Unified("a/main.go", "b/main.go", a, b, DefaultContext); got != want {
+		t.Errorf("Unexpected diff:\n%s\nwanted:\n%s", got, want)
+	}
+}
+
+func TestUnified_AddedFile(t *testing.T) {
+	want := `--- /dev/null
++++ b/util.go
+@@ -0,0 +1,2 @@
++package main
++func util() {}
+`
+
+	if got := Unified("/dev/null", "b/util.go", "", "package main\nfunc util() {}\n", DefaultContext); got != want {
+		t.Errorf("Unexpected diff:\n%s\nwanted:\n%s", got, want)
+	}
+}
+
+func TestUnified_SeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 30; i++ {
+		line := strings.Repeat("x", i)
+		a = append(a, line)
+		if i == 2 || i == 25 {
+			line += "changed"
+		}
+		b = append(b, line)
+	}
+
+	got := Unified("a", "b", strings.Join(a, "\n")+"\n", strings.Join(b, "\n")+"\n", DefaultContext)
+
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Errorf("Expected 2 hunks, got %d:\n%s", n, got)
+	}
+
+	if !strings.Contains(got, "@@ -1,6 +1,6 @@") || !strings.Contains(got, "@@ -23,7 +23,7 @@") {
+		t.Errorf("Unexpected hunk ranges:\n%s", got)
+	}
+}
+
+func TestUnified_NoNewlineAtEnd(t *testing.T) {
+	got := Unified("a", "b", "one\ntwo", "one\nthree", DefaultContext)
+
+	if !strings.Contains(got, "-two\n\\ No newline at end of file\n+three\n\\ No newline at end of file\n") {
+		t.Errorf("Expected missing newlines to be marked:\n%s", got)
+	}
+}
@@ -30,24 +30,53 @@ func GetOr(key EnvKey, fallback string) string {
 }
 
 func InitEnv() error {
+	if missing := Check(); len(missing) > 0 {
+		log.Fatalf("Missing required key %s", missing[0].String())
+	}
+
+	return nil
+}
 
+/*
+Check loads the environment in the same way as InitEnv, returning the required keys which aren't set instead of
+exiting
+*/
+func Check() []EnvKey {
 	godotenv.Load()
 
 	input := make(map[EnvKey]string)
+	var missing []EnvKey
 
 	for key := env_none + 1; key < env_none_final; key++ {
 		envVar := os.Getenv(key.String())
 		isOpt := strings.HasPrefix(key.String(), "OPT_")
 
+		if requiredWhen, ok := conditional[key]; ok {
+			isOpt = !requiredWhen()
+		}
+
 		if envVar == "" && !isOpt {
-			log.Fatalf("Missing required key %s", key.String())
+			missing = append(missing, key)
 		} else if envVar != "" {
 			input[key] = envVar
 		}
 	}
 
 	env = input
-	return nil
+	return missing
+}
+
+// conditional holds keys which are only required for certain configurations, the key is required
+// when the function returns true
+var conditional = map[EnvKey]func() bool{
+	S3_ACCESS_KEY_ID:     usingS3Storage,
+	S3_SECRET_ACCESS_KEY: usingS3Storage,
+	S3_BUCKET:            usingS3Storage,
+}
+
+func usingS3Storage() bool {
+	driver := os.Getenv(OPT_STORAGE_DRIVER.String())
+	return driver == "" || driver == "s3"
 }
 
 func Set(key EnvKey, value string) {
@@ -74,6 +103,36 @@ const (
 	S3_ACCESS_KEY_ID
 	S3_SECRET_ACCESS_KEY
 	S3_BUCKET
+	OPT_S3_ENDPOINT
+	OPT_S3_REGION
+	OPT_S3_FORCE_PATH_STYLE
+	OPT_S3_SSE
+	OPT_S3_SSE_KMS_KEY_ID
+	OPT_S3_KEY_PREFIX
+
+	// Storage
+	OPT_STORAGE_DRIVER
+	OPT_STORAGE_LOCAL_DIR
+	OPT_STORAGE_SIGNING_SECRET
+	OPT_PUBLIC_URL
+	OPT_GC_INTERVAL
+
+	// Quotas
+	OPT_QUOTA_MAX_FILE_SIZE
+	OPT_QUOTA_MAX_FILES
+	OPT_QUOTA_MAX_PROJECTS
+	OPT_QUOTA_MAX_STORAGE
+
+	// Compilation
+	OPT_COMPILE_WORKERS
+	OPT_COMPILE_CONCURRENCY
+	OPT_COMPILE_TIMEOUT
+	OPT_COMPILE_MAX_MEMORY
+	OPT_SANDBOX_REQUIRED
+	OPT_BUILD_CACHE_SIZE
+	OPT_TOOLCHAINS_DIR
+	OPT_TINYGO_VERSION
+	OPT_ASC_VERSION
 
 	JWT_SECRET
 
@@ -106,6 +165,54 @@ func (e EnvKey) String() string {
 		return "S3_SECRET_ACCESS_KEY"
 	case S3_BUCKET:
 		return "S3_BUCKET"
+	case OPT_S3_ENDPOINT:
+		return "OPT_S3_ENDPOINT"
+	case OPT_S3_REGION:
+		return "OPT_S3_REGION"
+	case OPT_S3_FORCE_PATH_STYLE:
+		return "OPT_S3_FORCE_PATH_STYLE"
+	case OPT_S3_SSE:
+		return "OPT_S3_SSE"
+	case OPT_S3_SSE_KMS_KEY_ID:
+		return "OPT_S3_SSE_KMS_KEY_ID"
+	case OPT_S3_KEY_PREFIX:
+		return "OPT_S3_KEY_PREFIX"
+	case OPT_STORAGE_DRIVER:
+		return "OPT_STORAGE_DRIVER"
+	case OPT_STORAGE_LOCAL_DIR:
+		return "OPT_STORAGE_LOCAL_DIR"
+	case OPT_STORAGE_SIGNING_SECRET:
+		return "OPT_STORAGE_SIGNING_SECRET"
+	case OPT_PUBLIC_URL:
+		return "OPT_PUBLIC_URL"
+	case OPT_GC_INTERVAL:
+		return "OPT_GC_INTERVAL"
+	case OPT_QUOTA_MAX_FILE_SIZE:
+		return "OPT_QUOTA_MAX_FILE_SIZE"
+	case OPT_QUOTA_MAX_FILES:
+		return "OPT_QUOTA_MAX_FILES"
+	case OPT_QUOTA_MAX_PROJECTS:
+		return "OPT_QUOTA_MAX_PROJECTS"
+	case OPT_QUOTA_MAX_STORAGE:
+		return "OPT_QUOTA_MAX_STORAGE"
+	case OPT_COMPILE_WORKERS:
+		return "OPT_COMPILE_WORKERS"
+	case OPT_COMPILE_CONCURRENCY:
+		return "OPT_COMPILE_CONCURRENCY"
+	case OPT_COMPILE_TIMEOUT:
+		return "OPT_COMPILE_TIMEOUT"
+	case OPT_COMPILE_MAX_MEMORY:
+		return "OPT_COMPILE_MAX_MEMORY"
+	case OPT_SANDBOX_REQUIRED:
+		return "OPT_SANDBOX_REQUIRED"
+	case OPT_BUILD_CACHE_SIZE:
+		return "OPT_BUILD_CACHE_SIZE"
+	case OPT_TOOLCHAINS_DIR:
+		return "OPT_TOOLCHAINS_DIR"
+	case OPT_TINYGO_VERSION:
+		return "OPT_TINYGO_VERSION"
+	case OPT_ASC_VERSION:
+		return "OPT_ASC_VERSION"
 	case CORS_ALLOW_ORIGIN:
 		return "CORS_ALLOW_ORIGIN"
 	default:
@@ -31,7 +31,7 @@ require (
 require (
 	github.com/aws/aws-sdk-go v1.44.134
 	github.com/gin-contrib/cors v1.4.0
-	github.com/gin-contrib/sse v0.1.0 // indirect
+	github.com/gin-contrib/sse v0.1.0
 	github.com/go-playground/locales v0.14.0 // indirect
 	github.com/go-playground/universal-translator v0.18.0 // indirect
 	github.com/go-playground/validator/v10 v10.11.1 // indirect
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+)
+
+// Asset is a binary file (image, font, data file, prebuilt wasm...) stored alongside a project's source files
+type Asset struct {
+	ID          string `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ProjectID   string `gorm:"uniqueIndex:idx_assets_project_path"`
+	Path        string `gorm:"uniqueIndex:idx_assets_project_path"`
+	ContentType string
+	Size        int64
+	StoredSize  int64 // StoredSize is the number of bytes the asset takes in storage after compression
+}
+
+// AssetView describes an asset without its contents
+type AssetView struct {
+	Path        string    `json:"path"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (a *Asset) View() AssetView {
+	return AssetView{
+		Path:        a.Path,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		UpdatedAt:   a.UpdatedAt,
+	}
+}
+
+func AssetsToAssetViews(assets []Asset) []AssetView {
+	views := make([]AssetView, len(assets))
+	for i := range assets {
+		views[i] = assets[i].View()
+	}
+
+	return views
+}
+
+func NewAsset(projectID, path, contentType string, size int64) Asset {
+	return Asset{
+		ID:          NewID(),
+		ProjectID:   projectID,
+		Path:        path,
+		ContentType: contentType,
+		Size:        size,
+	}
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+Blob is a piece of file content held in storage under the SHA-256 hash of the content. Blobs are shared between every
+project file with the same content, RefCount is the number of manifests referring to the blob and a blob with no
+references can be reclaimed.
+*/
+type Blob struct {
+	Hash       string `gorm:"primaryKey"`
+	Size       int64
+	StoredSize int64 // StoredSize is the number of bytes held in storage after compression, 0 if stored uncompressed
+	RefCount   int   `gorm:"default:0;index"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// HashContent returns the hash used to address a blob with the given content
+func HashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Manifest maps the path of each file in a project to the hash of the blob holding its content
+type Manifest map[string]string
+
+// Hashes returns each distinct hash referenced by the manifest in sorted order
+func (m Manifest) Hashes() []string {
+	seen := make(map[string]bool, len(m))
+	hashes := make([]string, 0, len(m))
+	for _, h := range m {
+		if !seen[h] {
+			seen[h] = true
+			hashes = append(hashes, h)
+		}
+	}
+	sort.Strings(hashes)
+
+	return hashes
+}
+
+// Copy returns a copy of the manifest which can be modified without affecting the original
+func (m Manifest) Copy() Manifest {
+	c := make(Manifest, len(m))
+	for p, h := range m {
+		c[p] = h
+	}
+
+	return c
+}
+
+// Merge returns a copy of the manifest with the paths in changes added or replaced
+func (m Manifest) Merge(changes Manifest) Manifest {
+	merged := m.Copy()
+	for p, h := range changes {
+		merged[p] = h
+	}
+
+	return merged
+}
+
+// Value stores a manifest as JSON, a nil manifest is stored as NULL
+func (m Manifest) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (m *Manifest) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a manifest", value)
+	}
+
+	return json.Unmarshal(b, m)
+}
@@ -0,0 +1,71 @@
+package model
+
+import "testing"
+
+func TestManifest_Hashes(t *testing.T) {
+	m := Manifest{
+		"main.go":     HashContent("package main"),
+		"lib/main.go": HashContent("package main"),
+		"index.html":  HashContent("<h1>Hello</h1>"),
+	}
+
+	if len(m.Hashes()) != 2 {
+		t.Errorf("Expected identical content to share a hash, got %d hashes", len(m.Hashes()))
+	}
+}
+
+func TestManifest_Merge(t *testing.T) {
+	head := Manifest{
+		"main.go":    HashContent("package main"),
+		"index.html": HashContent("<h1>Hello</h1>"),
+	}
+
+	merged := head.Merge(Manifest{
+		"main.go":    HashContent("package main\n"),
+		"lib/lib.go": HashContent("package lib"),
+	})
+
+	if len(merged) != 3 {
+		t.Fatalf("Expected 3 files after merging, got %d", len(merged))
+	}
+
+	if merged["main.go"] != HashContent("package main\n") {
+		t.Error("Expected main.go to be replaced")
+	}
+
+	if merged["index.html"] != head["index.html"] {
+		t.Error("Expected index.html to be left unchanged")
+	}
+
+	if head["main.go"] != HashContent("package main") || len(head) != 2 {
+		t.Error("Expected merging to leave the original manifest unchanged")
+	}
+}
+
+func TestManifest_ValueAndScan(t *testing.T) {
+	m := Manifest{"main.go": HashContent("package main")}
+
+	v, err := m.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scanned Manifest
+	if err := scanned.Scan([]byte(v.(string))); err != nil {
+		t.Fatal(err)
+	}
+
+	if scanned["main.go"] != m["main.go"] {
+		t.Errorf("Expected manifest to survive a round trip, got %v", scanned)
+	}
+
+	var empty Manifest
+	if v, err := empty.Value(); err != nil || v != nil {
+		t.Errorf("Expected a nil manifest to be stored as NULL, got %v", v)
+	}
+
+	scanned = Manifest{}
+	if err := scanned.Scan(nil); err != nil || scanned != nil {
+		t.Errorf("Expected NULL to be scanned as a nil manifest, got %v", scanned)
+	}
+}
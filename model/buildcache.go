@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+/*
+BuildCacheEntry is a build held in the build cache, keyed by a hash of everything which decides what the build
+produced. The artifacts are kept in storage and copied to each project which builds the same thing.
+*/
+type BuildCacheEntry struct {
+	Key         string       `gorm:"primaryKey"`
+	Artifacts   JobArtifacts `gorm:"type:jsonb"`
+	Diagnostics Diagnostics  `gorm:"type:jsonb"` // Diagnostics are the warnings reported when the build was compiled
+	Toolchain   string       // Toolchain is the compiler and the version of it the build was compiled with
+	StoredSize  int64        // StoredSize is the number of bytes the artifacts take up in storage
+	Hits        int
+	CreatedAt   time.Time
+	LastUsedAt  time.Time `gorm:"index"`
+}
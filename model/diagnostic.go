@@ -0,0 +1,60 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+/*
+Diagnostic is a problem reported by a compiler, located in a project's source files so that it can be marked in the
+editor. File is empty and Line and Column are 0 for problems which aren't found in a particular file.
+*/
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"` // Code identifies the kind of problem, such as TS2322, where the compiler gives one
+}
+
+// Diagnostics is a list of diagnostics stored as JSON
+type Diagnostics []Diagnostic
+
+// Value stores diagnostics as JSON, no diagnostics are stored as NULL
+func (d Diagnostics) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal([]Diagnostic(d))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (d *Diagnostics) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into diagnostics", value)
+	}
+
+	return json.Unmarshal(b, d)
+}
@@ -3,26 +3,38 @@ package model
 import (
 	"errors"
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 )
 
 func languageFromFileName(fileName string) string {
-	return strings.Split(fileName, ".")[1]
+	return strings.TrimPrefix(path.Ext(fileName), ".")
 }
 
 /*
-ProjectFiles are represented as a map of file name to file content
+ProjectFiles are represented as a map of file path (relative to the project source directory, e.g. lib/math.go) to file content
 */
 type ProjectFiles map[string]string
 
+// Paths returns the paths of each of the files in sorted order
+func (files ProjectFiles) Paths() []string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
 func ProjectFilesToFileViews(files ProjectFiles) []FileView {
 	var fileViews []FileView
-	for path, content := range files {
-		fmt.Println(path, strings.Split(path, "."))
+	for _, p := range files.Paths() {
 		fileViews = append(fileViews, FileView{
-			Name:     path,
-			Content:  content,
-			Language: languageFromFileName(path),
+			Name:     p,
+			Content:  files[p],
+			Language: languageFromFileName(p),
 		})
 	}
 	return fileViews
@@ -37,11 +49,53 @@ func FileViewsToProjectFiles(fileViews []FileView) ProjectFiles {
 }
 
 type FileView struct {
-	Name     string `json:"name"`
+	Name     string `json:"name"` // Name is the path of the file relative to the project source directory
 	Content  string `json:"content"`
 	Language string `json:"language"`
 }
 
+/*
+CleanFilePath validates a path given for a project file and returns it in its canonical form, paths must be relative
+and cannot leave the project source directory
+*/
+func CleanFilePath(p string) (string, error) {
+	if p == "" || strings.HasPrefix(p, "/") || strings.ContainsAny(p, "\\\x00") {
+		return "", fmt.Errorf("invalid file path %q", p)
+	}
+
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("invalid file path %q", p)
+		}
+	}
+
+	cleaned := path.Clean(p)
+	if cleaned == "." {
+		return "", fmt.Errorf("invalid file path %q", p)
+	}
+
+	return cleaned, nil
+}
+
+// CleanProjectFiles validates every path in a set of project files, returning the files keyed by their canonical paths
+func CleanProjectFiles(files ProjectFiles) (ProjectFiles, error) {
+	cleaned := make(ProjectFiles, len(files))
+	for p, content := range files {
+		c, err := CleanFilePath(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := cleaned[c]; ok {
+			return nil, fmt.Errorf("duplicate file path %q", c)
+		}
+
+		cleaned[c] = content
+	}
+
+	return cleaned, nil
+}
+
 var DefaultGo = `package main
 
 import (
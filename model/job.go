@@ -0,0 +1,181 @@
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// JobStatus is the state of a compile job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Finished reports whether a job has stopped running, either successfully or not
+func (s JobStatus) Finished() bool {
+	return s == JobSucceeded || s == JobFailed
+}
+
+// JobArtifacts maps the name of each file written by a compile job to its size in bytes
+type JobArtifacts map[string]int64
+
+// Value stores the artifacts of a job as JSON, a job without artifacts is stored as NULL
+func (a JobArtifacts) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(map[string]int64(a))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (a *JobArtifacts) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into job artifacts", value)
+	}
+
+	return json.Unmarshal(b, a)
+}
+
+/*
+CompileJob is a request to build a project. Jobs are queued in the database and picked up by the compile workers, so a
+job outlives the request which created it.
+*/
+type CompileJob struct {
+	ID        string    `gorm:"primaryKey"`
+	ProjectID string    `gorm:"index"`
+	UserID    string    `gorm:"index"`
+	Status    JobStatus `gorm:"index"`
+	Revision  int       // Revision is the revision of the project's files which was built, it is set once the job starts
+	Error     string
+	Artifacts JobArtifacts `gorm:"type:jsonb"`
+	// Diagnostics are the problems reported by the compiler, a job which failed to compile has at least one error
+	Diagnostics Diagnostics `gorm:"type:jsonb"`
+	CacheHit    bool        // CacheHit is whether the artifacts were copied from the build cache instead of compiled
+	Toolchain   string      // Toolchain is the compiler and the exact version of it the job built with, such as tinygo 0.26.0
+	CreatedAt   time.Time   `gorm:"index"`
+	StartedAt   sql.NullTime
+	FinishedAt  sql.NullTime
+	// HeartbeatAt is when the worker running the job last reported that it is still running it
+	HeartbeatAt sql.NullTime
+	// Attempts is the number of times the job has been claimed, a worker only records the result of its own attempt
+	Attempts int `gorm:"default:0"`
+	// CompilerQueueDepth is the number of compiles waiting for a compiler process when the job was ready to build
+	CompilerQueueDepth int
+	CompilerWaitMs     int64 // CompilerWaitMs is how long the job waited for a compiler process
+}
+
+func NewCompileJob(userId, projectId string) CompileJob {
+	return CompileJob{
+		ID:        NewID(),
+		ProjectID: projectId,
+		UserID:    userId,
+		Status:    JobQueued,
+	}
+}
+
+type ArtifactView struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+type CompileJobView struct {
+	ID         string     `json:"id"`
+	ProjectID  string     `json:"project_id"`
+	Status     JobStatus  `json:"status"`
+	Revision   int        `json:"revision"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	QueuedMs   int64      `json:"queued_ms"`   // QueuedMs is how long the job waited before it started
+	DurationMs int64      `json:"duration_ms"` // DurationMs is how long the job took to run once it started
+	// QueuePosition is the number of jobs queued ahead of a job which hasn't started
+	QueuePosition      int            `json:"queue_position"`
+	CompilerQueueDepth int            `json:"compiler_queue_depth"`
+	CompilerWaitMs     int64          `json:"compiler_wait_ms"`
+	Artifacts          []ArtifactView `json:"artifacts"`
+	Diagnostics        []Diagnostic   `json:"diagnostics"`
+	CacheHit           bool           `json:"cache_hit"`
+	Toolchain          string         `json:"toolchain,omitempty"`
+	// LogURL is a signed link to follow the job's log which doesn't need the Authorization header, until it expires
+	LogURL string `json:"log_url"`
+}
+
+/*
+View describes a job, url returns the link to each of its artifacts. The timings of a job which hasn't finished are
+measured up to now.
+*/
+func (j *CompileJob) View(url func(name string) string) CompileJobView {
+	view := CompileJobView{
+		ID:        j.ID,
+		ProjectID: j.ProjectID,
+		Status:    j.Status,
+		Revision:  j.Revision,
+		Error:     j.Error,
+		CreatedAt: j.CreatedAt,
+		Artifacts: []ArtifactView{},
+
+		Diagnostics: append([]Diagnostic{}, j.Diagnostics...),
+		CacheHit:    j.CacheHit,
+		Toolchain:   j.Toolchain,
+
+		CompilerQueueDepth: j.CompilerQueueDepth,
+		CompilerWaitMs:     j.CompilerWaitMs,
+	}
+
+	now := time.Now()
+	started := now
+	if j.StartedAt.Valid {
+		started = j.StartedAt.Time
+		view.StartedAt = &j.StartedAt.Time
+	}
+	view.QueuedMs = started.Sub(j.CreatedAt).Milliseconds()
+
+	if j.StartedAt.Valid {
+		finished := now
+		if j.FinishedAt.Valid {
+			finished = j.FinishedAt.Time
+			view.FinishedAt = &j.FinishedAt.Time
+		}
+		view.DurationMs = finished.Sub(started).Milliseconds()
+	}
+
+	names := make([]string, 0, len(j.Artifacts))
+	for name := range j.Artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		view.Artifacts = append(view.Artifacts, ArtifactView{
+			Name: name,
+			URL:  url(name),
+			Size: j.Artifacts[name],
+		})
+	}
+
+	return view
+}
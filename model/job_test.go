@@ -0,0 +1,76 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestCompileJob_View(t *testing.T) {
+	created := time.Now().Add(-time.Minute)
+	job := CompileJob{
+		ID:         "job",
+		ProjectID:  "project",
+		Status:     JobSucceeded,
+		Revision:   3,
+		Artifacts:  JobArtifacts{"main.wat": 200, "main.wasm": 100},
+		CreatedAt:  created,
+		StartedAt:  sql.NullTime{Time: created.Add(2 * time.Second), Valid: true},
+		FinishedAt: sql.NullTime{Time: created.Add(7 * time.Second), Valid: true},
+	}
+
+	view := job.View(func(name string) string { return "/build/" + name })
+
+	if view.QueuedMs != 2000 || view.DurationMs != 5000 {
+		t.Errorf("Expected 2000ms queued and 5000ms running, got %d and %d", view.QueuedMs, view.DurationMs)
+	}
+
+	if len(view.Artifacts) != 2 || view.Artifacts[0].Name != "main.wasm" || view.Artifacts[0].URL != "/build/main.wasm" {
+		t.Errorf("Expected the artifacts to be listed by name with their links, got %+v", view.Artifacts)
+	}
+
+	if view.Artifacts[1].Size != 200 {
+		t.Errorf("Expected main.wat to be 200 bytes, got %d", view.Artifacts[1].Size)
+	}
+}
+
+func TestCompileJob_ViewQueued(t *testing.T) {
+	job := NewCompileJob("user", "project")
+	job.CreatedAt = time.Now().Add(-time.Second)
+
+	view := job.View(func(name string) string { return name })
+
+	if view.StartedAt != nil || view.FinishedAt != nil || view.DurationMs != 0 {
+		t.Errorf("Expected a queued job to have no run time, got %+v", view)
+	}
+
+	if view.QueuedMs < 1000 {
+		t.Errorf("Expected a queued job to have been waiting for at least 1000ms, got %d", view.QueuedMs)
+	}
+
+	if view.Artifacts == nil || view.Status.Finished() {
+		t.Errorf("Expected an unfinished job with no artifacts, got %+v", view)
+	}
+}
+
+func TestJobArtifacts_ValueAndScan(t *testing.T) {
+	a := JobArtifacts{"main.wasm": 100}
+
+	v, err := a.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scanned JobArtifacts
+	if err := scanned.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if scanned["main.wasm"] != 100 {
+		t.Errorf("Expected main.wasm to be 100 bytes, got %v", scanned)
+	}
+
+	if v, _ := JobArtifacts(nil).Value(); v != nil {
+		t.Errorf("Expected no artifacts to be stored as NULL, got %v", v)
+	}
+}
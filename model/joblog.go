@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// JobLogEvent is the kind of an entry in the log of a compile job
+type JobLogEvent string
+
+const (
+	JobLogStart  JobLogEvent = "start"  // JobLogStart is logged when a job starts, with how long it was queued
+	JobLogOutput JobLogEvent = "output" // JobLogOutput is a line written by a compiler
+	JobLogFinish JobLogEvent = "finish" // JobLogFinish is logged when a job finishes, with how long it ran
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+/*
+CompileJobLog is an entry in the log of a compile job. Entries are numbered from 1 in the order they were logged so that
+clients can pick up where they left off.
+*/
+type CompileJobLog struct {
+	JobID      string      `gorm:"primaryKey"`
+	Seq        int         `gorm:"primaryKey"`
+	Event      JobLogEvent // Event is the kind of entry
+	Stream     string      // Stream is where the compiler wrote an output line, either stdout or stderr
+	Text       string      // Text is the line written by the compiler, or the status of a job which finished
+	DurationMs int64       // DurationMs is how long a job was queued when it started, or how long it ran once it finished
+	CreatedAt  time.Time
+}
+
+type CompileJobLogView struct {
+	Seq        int         `json:"seq"`
+	Event      JobLogEvent `json:"event"`
+	Stream     string      `json:"stream,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+	Time       time.Time   `json:"time"`
+}
+
+func (l *CompileJobLog) View() CompileJobLogView {
+	return CompileJobLogView{
+		Seq:        l.Seq,
+		Event:      l.Event,
+		Stream:     l.Stream,
+		Text:       l.Text,
+		DurationMs: l.DurationMs,
+		Time:       l.CreatedAt,
+	}
+}
@@ -6,12 +6,17 @@ import (
 	"github.com/sammyhass/web-ide/server/db"
 )
 
+// Tables returns a value of each model stored in the database
+func Tables() []interface{} {
+	return []interface{}{&User{}, &Project{}, &Asset{}, &Blob{}, &Revision{}, &CompileJob{}, &CompileJobLog{}, &BuildCacheEntry{}}
+}
+
 // Migrate performs a database migration
 func Migrate() {
 
 	conn := db.GetConnection()
 
-	if err := conn.AutoMigrate(&User{}, &Project{}); err != nil {
+	if err := conn.AutoMigrate(Tables()...); err != nil {
 		log.Fatalf("Migration Failed: %v", err)
 	}
 }
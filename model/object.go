@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// ObjectInfo describes a file as it was put in storage
+type ObjectInfo struct {
+	Size            int64 // Size is the length of the file's content
+	StoredSize      int64 // StoredSize is the number of bytes held in storage, smaller than Size when compressed
+	ContentType     string
+	ContentEncoding string // ContentEncoding is set when the file is held compressed
+	ETag            string // ETag identifies the stored content of the file, it is only set by Stat
+	ModTime         time.Time
+}
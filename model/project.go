@@ -33,6 +33,18 @@ func (l ProjectLanguage) String() string {
 	return langs[l]
 }
 
+// EntryFile is the source file a project written in the language is compiled from
+func (l ProjectLanguage) EntryFile() string {
+	switch l {
+	case LanguageGo:
+		return "main.go"
+	case LanguageAssemblyScript:
+		return "main.ts"
+	}
+
+	return ""
+}
+
 type Project struct {
 	*gorm.Model
 	ID        string `gorm:"primaryKey" json:"id"`
@@ -42,17 +54,33 @@ type Project struct {
 	Language  ProjectLanguage `gorm:"default:0"`
 	IsShared  bool            `gorm:"default:false"`
 	ShareCode sql.NullString  `gorm:"uniqueIndex"`
+	Manifest  Manifest        `gorm:"type:jsonb"` // Manifest is nil for projects whose files have not yet been moved to blob storage
+	Revision  int             `gorm:"default:0"`  // Revision is the number of the latest revision of the project's files
+	BuildSize int64           `gorm:"default:0"`  // BuildSize is the number of bytes taken by the latest build of the project
+	// BuildStoredSize is the number of bytes the latest build takes in storage after compression
+	BuildStoredSize int64 `gorm:"default:0"`
+	// BuildRevision is the revision of the project's files the latest build was built from
+	BuildRevision int `gorm:"default:0"`
+	// BuildSettings are the options the project is compiled with
+	BuildSettings BuildSettings `gorm:"type:jsonb"`
+	// CompilerVersion is the version of the compiler the project is pinned to, it is empty until the project is pinned
+	CompilerVersion string
 }
 
 type ProjectView struct {
-	ID        string     `json:"id"`
-	CreatedAt time.Time  `json:"created_at"`
-	Name      string     `json:"name"`
-	UserID    string     `json:"user_id"`
-	Files     []FileView `json:"files"`
-	WasmPath  string     `json:"wasm_path"`
-	Language  string     `json:"language"`
-	ShareCode string     `json:"share_code"`
+	ID        string      `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Name      string      `json:"name"`
+	UserID    string      `json:"user_id"`
+	Files     []FileView  `json:"files"`
+	Assets    []AssetView `json:"assets"`
+	WasmPath  string      `json:"wasm_path"`
+	Language  string      `json:"language"`
+	ShareCode string      `json:"share_code"`
+	Revision  int         `json:"revision"`
+
+	BuildSettings   BuildSettings `json:"build_settings"`
+	CompilerVersion string        `json:"compiler_version"`
 }
 
 func (p *Project) View() ProjectView {
@@ -63,6 +91,10 @@ func (p *Project) View() ProjectView {
 		UserID:    p.UserID,
 		Language:  p.Language.String(),
 		ShareCode: p.ShareCode.String,
+		Revision:  p.Revision,
+
+		BuildSettings:   p.BuildSettings,
+		CompilerVersion: p.CompilerVersion,
 	}
 }
 
@@ -98,5 +130,6 @@ func NewProject(
 			String: "",
 			Valid:  false,
 		},
+		Manifest: Manifest{},
 	}
 }
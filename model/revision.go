@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+)
+
+// Revision is an immutable record of the files of a project at the time they were saved
+type Revision struct {
+	ID         string `gorm:"primaryKey"`
+	ProjectID  string `gorm:"uniqueIndex:idx_revisions_project_number"`
+	Number     int    `gorm:"uniqueIndex:idx_revisions_project_number"`
+	Message    string
+	Manifest   Manifest `gorm:"type:jsonb"`
+	Size       int64    // Size is the number of bytes of content added by the revision
+	StoredSize int64    // StoredSize is the number of bytes the content added by the revision takes in storage
+	CreatedAt  time.Time
+}
+
+type RevisionView struct {
+	Number     int       `json:"number"`
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"created_at"`
+	FileCount  int       `json:"file_count"`
+	Size       int64     `json:"size"`
+	StoredSize int64     `json:"stored_size"`
+}
+
+func (r *Revision) View() RevisionView {
+	return RevisionView{
+		Number:     r.Number,
+		Message:    r.Message,
+		CreatedAt:  r.CreatedAt,
+		FileCount:  len(r.Manifest),
+		Size:       r.Size,
+		StoredSize: r.StoredSize,
+	}
+}
+
+func NewRevision(projectID string, number int, message string, manifest Manifest) Revision {
+	return Revision{
+		ID:        NewID(),
+		ProjectID: projectID,
+		Number:    number,
+		Message:   message,
+		Manifest:  manifest,
+	}
+}
+
+// FileDiff describes how a single file changed between two revisions
+type FileDiff struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // Status is one of added, removed or modified
+}
+
+// RevisionDiff is the difference between two revisions of a project
+type RevisionDiff struct {
+	From  int        `json:"from"`
+	To    int        `json:"to"`
+	Files []FileDiff `json:"files"`
+	Diff  string     `json:"diff"` // Diff is a unified diff of every changed file
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+BuildSettings are the options a project is compiled with, a setting which is left empty uses the compiler's default.
+Which settings can be used depends on the language of the project.
+*/
+type BuildSettings struct {
+	Optimize string `json:"optimize,omitempty"` // Optimize is the optimization level, such as 2, s or z
+	Debug    *bool  `json:"debug,omitempty"`    // Debug is whether debug info is included in the build
+	// GC is the garbage collector used by TinyGo
+	GC string `json:"gc,omitempty"`
+	// Scheduler is the goroutine scheduler used by TinyGo
+	Scheduler string `json:"scheduler,omitempty"`
+	// Panic is what TinyGo does when the program panics
+	Panic string `json:"panic,omitempty"`
+	// Runtime is the AssemblyScript runtime, which decides how memory is managed
+	Runtime string `json:"runtime,omitempty"`
+	// ExportRuntime is whether the AssemblyScript runtime's functions are exported from the module
+	ExportRuntime bool `json:"export_runtime,omitempty"`
+	// Tags are the build tags Go files are built with
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Value stores build settings as JSON
+func (s BuildSettings) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan reads build settings stored as JSON, projects created before settings were stored have the default settings
+func (s *BuildSettings) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*s = BuildSettings{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into build settings", value)
+	}
+
+	return json.Unmarshal(b, s)
+}
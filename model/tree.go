@@ -0,0 +1,263 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FileTreeNode is a single file or directory in the tree view of a project's source files
+type FileTreeNode struct {
+	Name     string          `json:"name"`
+	Path     string          `json:"path"`
+	IsDir    bool            `json:"is_dir"`
+	Language string          `json:"language,omitempty"`
+	Children []*FileTreeNode `json:"children,omitempty"`
+}
+
+/*
+BuildFileTree arranges a set of project files into a tree of directories, the returned node is the root of the project
+source directory. Directories and files are each listed in alphabetical order with directories first.
+*/
+func BuildFileTree(files ProjectFiles) *FileTreeNode {
+	root := &FileTreeNode{IsDir: true}
+	dirs := map[string]*FileTreeNode{"": root}
+
+	// ensure the directory at the given path exists, creating any missing parents
+	var mkdir func(dir string) *FileTreeNode
+	mkdir = func(dir string) *FileTreeNode {
+		if node, ok := dirs[dir]; ok {
+			return node
+		}
+
+		parent, name := "", dir
+		if i := strings.LastIndex(dir, "/"); i >= 0 {
+			parent, name = dir[:i], dir[i+1:]
+		}
+
+		node := &FileTreeNode{Name: name, Path: dir, IsDir: true}
+		p := mkdir(parent)
+		p.Children = append(p.Children, node)
+		dirs[dir] = node
+
+		return node
+	}
+
+	for _, p := range files.Paths() {
+		dir, name := "", p
+		if i := strings.LastIndex(p, "/"); i >= 0 {
+			dir, name = p[:i], p[i+1:]
+		}
+
+		parent := mkdir(dir)
+		parent.Children = append(parent.Children, &FileTreeNode{
+			Name:     name,
+			Path:     p,
+			Language: languageFromFileName(name),
+		})
+	}
+
+	sortFileTree(root)
+	return root
+}
+
+// sortFileTree orders the children of a directory and every directory within it by name, with directories first
+func sortFileTree(node *FileTreeNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+
+		return a.Name < b.Name
+	})
+
+	for _, child := range node.Children {
+		if child.IsDir {
+			sortFileTree(child)
+		}
+	}
+}
+
+var (
+	errPathNotFound = errors.New("no files found at the given path")
+	errMoveIntoSelf = errors.New("cannot move a directory inside of itself")
+)
+
+/*
+MoveFiles moves the file or directory at from to the path to. It returns the files which now exist at their new paths
+along with the old paths which should be removed.
+*/
+func MoveFiles(files ProjectFiles, from, to string) (moved ProjectFiles, removed []string, err error) {
+	from, err = CleanFilePath(from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to, err = CleanFilePath(to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if from == to {
+		return ProjectFiles{}, nil, nil
+	}
+
+	if strings.HasPrefix(to, from+"/") {
+		return nil, nil, errMoveIntoSelf
+	}
+
+	moved = make(ProjectFiles)
+	for _, p := range files.Paths() {
+		var dest string
+		switch {
+		case p == from:
+			dest = to
+		case strings.HasPrefix(p, from+"/"):
+			dest = to + strings.TrimPrefix(p, from)
+		default:
+			continue
+		}
+
+		moved[dest] = files[p]
+		removed = append(removed, p)
+	}
+
+	if len(removed) == 0 {
+		return nil, nil, errPathNotFound
+	}
+
+	remaining := make(map[string]bool, len(files))
+	for p := range files {
+		remaining[p] = true
+	}
+	for _, p := range removed {
+		delete(remaining, p)
+	}
+
+	for dest := range moved {
+		if pathConflicts(remaining, dest) {
+			return nil, nil, fmt.Errorf("a file already exists at %s", dest)
+		}
+	}
+
+	return moved, removed, nil
+}
+
+// pathConflicts reports whether a file can not be created at p, either because something already exists there or
+// because one of its parent directories is a file
+func pathConflicts(existing map[string]bool, p string) bool {
+	if existing[p] {
+		return true
+	}
+
+	for dir := p; strings.Contains(dir, "/"); {
+		dir = dir[:strings.LastIndex(dir, "/")]
+		if existing[dir] {
+			return true
+		}
+	}
+
+	for e := range existing {
+		if strings.HasPrefix(e, p+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+DeleteFiles returns the paths of the files which would be removed by deleting the file or directory at p
+*/
+func DeleteFiles(files ProjectFiles, p string) ([]string, error) {
+	p, err := CleanFilePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, f := range files.Paths() {
+		if f == p || strings.HasPrefix(f, p+"/") {
+			removed = append(removed, f)
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil, errPathNotFound
+	}
+
+	return removed, nil
+}
+
+const (
+	FileOpDelete = "delete"
+	FileOpMove   = "move"
+	FileOpRename = "rename" // FileOpRename is the same as FileOpMove
+)
+
+/*
+FileOperation is a single change to the layout of a project's files. Delete operations remove the file or directory at
+Path, move and rename operations move the file or directory at From to To.
+*/
+type FileOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path,omitempty"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+func (op FileOperation) String() string {
+	switch op.Op {
+	case FileOpDelete:
+		return fmt.Sprintf("Deleted %s", op.Path)
+	case FileOpRename:
+		return fmt.Sprintf("Renamed %s to %s", op.From, op.To)
+	default:
+		return fmt.Sprintf("Moved %s to %s", op.From, op.To)
+	}
+}
+
+/*
+ApplyFileOperations applies each operation in order to a copy of files, returning the files left once they have all been
+applied. Nothing is returned if any of the operations can't be applied.
+*/
+func ApplyFileOperations(files ProjectFiles, ops []FileOperation) (ProjectFiles, error) {
+	if len(ops) == 0 {
+		return nil, errors.New("no file operations given")
+	}
+
+	result := make(ProjectFiles, len(files))
+	for p, content := range files {
+		result[p] = content
+	}
+
+	for i, op := range ops {
+		var moved ProjectFiles
+		var removed []string
+		var err error
+
+		switch op.Op {
+		case FileOpDelete:
+			removed, err = DeleteFiles(result, op.Path)
+		case FileOpMove, FileOpRename:
+			moved, removed, err = MoveFiles(result, op.From, op.To)
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+
+		for _, p := range removed {
+			delete(result, p)
+		}
+		for p, content := range moved {
+			result[p] = content
+		}
+	}
+
+	return result, nil
+}
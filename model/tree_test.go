@@ -0,0 +1,210 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanFilePath(t *testing.T) {
+	valid := map[string]string{
+		"main.go":         "main.go",
+		"lib/math.go":     "lib/math.go",
+		"lib//math.go":    "lib/math.go",
+		"./lib/./math.go": "lib/math.go",
+		"lib/":            "lib",
+	}
+
+	for in, want := range valid {
+		got, err := CleanFilePath(in)
+		if err != nil {
+			t.Errorf("Expected %q to be valid, got %s", in, err)
+		}
+		if got != want {
+			t.Errorf("Expected %q to be cleaned to %q, got %q", in, want, got)
+		}
+	}
+
+	invalid := []string{"", ".", "/etc/passwd", "../main.go", "lib/../../main.go", "lib\\math.go"}
+	for _, in := range invalid {
+		if _, err := CleanFilePath(in); err == nil {
+			t.Errorf("Expected %q to be invalid", in)
+		}
+	}
+}
+
+func TestBuildFileTree(t *testing.T) {
+	tree := BuildFileTree(ProjectFiles{
+		"main.go":          "",
+		"lib/math.go":      "",
+		"lib/util/util.go": "",
+		"index.html":       "",
+	})
+
+	if !tree.IsDir || len(tree.Children) != 3 {
+		t.Fatalf("Expected root to contain 3 children, got %d", len(tree.Children))
+	}
+
+	lib := tree.Children[0]
+	if lib.Name != "lib" || !lib.IsDir {
+		t.Fatalf("Expected directories to be listed first, got %s", lib.Name)
+	}
+
+	if len(lib.Children) != 2 || lib.Children[0].Path != "lib/util" || lib.Children[1].Path != "lib/math.go" {
+		t.Errorf("Unexpected children of lib: %+v", lib.Children)
+	}
+
+	util := lib.Children[0]
+	if len(util.Children) != 1 || util.Children[0].Name != "util.go" || util.Children[0].Language != "go" {
+		t.Errorf("Unexpected children of lib/util: %+v", util.Children)
+	}
+
+	if tree.Children[1].Name != "index.html" || tree.Children[2].Name != "main.go" {
+		t.Errorf("Expected files to be sorted, got %s, %s", tree.Children[1].Name, tree.Children[2].Name)
+	}
+}
+
+func TestBuildFileTree_SortsDirectoriesByName(t *testing.T) {
+	// a-b/x.go sorts before a/x.go as a path, but a sorts before a-b as a name
+	tree := BuildFileTree(ProjectFiles{
+		"a-b/x.go":   "",
+		"a/x.go":     "",
+		"a/b-c/y.go": "",
+		"a/b/y.go":   "",
+		"a.go":       "",
+	})
+
+	var names []string
+	for _, child := range tree.Children {
+		names = append(names, child.Name)
+	}
+
+	if strings.Join(names, " ") != "a a-b a.go" {
+		t.Errorf("Expected directories sorted by name before files, got %v", names)
+	}
+
+	a := tree.Children[0]
+	if len(a.Children) != 3 || a.Children[0].Name != "b" || a.Children[1].Name != "b-c" || a.Children[2].Name != "x.go" {
+		t.Errorf("Expected nested directories to be sorted by name, got %+v", a.Children)
+	}
+}
+
+func TestMoveFiles_File(t *testing.T) {
+	files := ProjectFiles{"main.go": "a", "util.go": "b"}
+
+	moved, removed, err := MoveFiles(files, "util.go", "lib/util.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if moved["lib/util.go"] != "b" || len(moved) != 1 {
+		t.Errorf("Unexpected moved files: %v", moved)
+	}
+
+	if len(removed) != 1 || removed[0] != "util.go" {
+		t.Errorf("Unexpected removed files: %v", removed)
+	}
+}
+
+func TestMoveFiles_Directory(t *testing.T) {
+	files := ProjectFiles{"main.go": "a", "lib/math.go": "b", "lib/util/util.go": "c", "library.go": "d"}
+
+	moved, removed, err := MoveFiles(files, "lib", "pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(moved) != 2 || moved["pkg/math.go"] != "b" || moved["pkg/util/util.go"] != "c" {
+		t.Errorf("Unexpected moved files: %v", moved)
+	}
+
+	if len(removed) != 2 {
+		t.Errorf("Expected only the files inside lib to be removed, got %v", removed)
+	}
+}
+
+func TestMoveFiles_Conflicts(t *testing.T) {
+	files := ProjectFiles{"main.go": "a", "lib/math.go": "b", "util.go": "c"}
+
+	if _, _, err := MoveFiles(files, "util.go", "main.go"); err == nil {
+		t.Error("Expected an error when moving onto an existing file")
+	}
+
+	if _, _, err := MoveFiles(files, "util.go", "lib"); err == nil {
+		t.Error("Expected an error when moving onto an existing directory")
+	}
+
+	if _, _, err := MoveFiles(files, "util.go", "main.go/util.go"); err == nil {
+		t.Error("Expected an error when moving inside of a file")
+	}
+
+	if _, _, err := MoveFiles(files, "lib", "lib/nested"); err == nil {
+		t.Error("Expected an error when moving a directory inside of itself")
+	}
+
+	if _, _, err := MoveFiles(files, "missing.go", "other.go"); err == nil {
+		t.Error("Expected an error when moving a path which does not exist")
+	}
+}
+
+func TestDeleteFiles(t *testing.T) {
+	files := ProjectFiles{"main.go": "a", "lib/math.go": "b", "lib/util/util.go": "c", "library.go": "d"}
+
+	removed, err := DeleteFiles(files, "lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(removed) != 2 || removed[0] != "lib/math.go" || removed[1] != "lib/util/util.go" {
+		t.Errorf("Expected only the files inside lib to be removed, got %v", removed)
+	}
+
+	if _, err := DeleteFiles(files, "missing.go"); err == nil {
+		t.Error("Expected an error when deleting a path which does not exist")
+	}
+
+	if _, err := DeleteFiles(files, "../main.go"); err == nil {
+		t.Error("Expected an error when deleting a path outside of the project")
+	}
+}
+
+func TestApplyFileOperations(t *testing.T) {
+	files := ProjectFiles{"main.go": "a", "util.go": "b", "old/notes.txt": "c"}
+
+	result, err := ApplyFileOperations(files, []FileOperation{
+		{Op: FileOpRename, From: "util.go", To: "helpers.go"},
+		{Op: FileOpMove, From: "helpers.go", To: "lib/helpers.go"},
+		{Op: FileOpDelete, Path: "old"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 2 || result["main.go"] != "a" || result["lib/helpers.go"] != "b" {
+		t.Errorf("Unexpected files: %v", result)
+	}
+
+	if len(files) != 3 || files["util.go"] != "b" {
+		t.Errorf("Expected the original files to be left unchanged, got %v", files)
+	}
+}
+
+func TestApplyFileOperations_Errors(t *testing.T) {
+	files := ProjectFiles{"main.go": "a", "util.go": "b"}
+
+	if _, err := ApplyFileOperations(files, nil); err == nil {
+		t.Error("Expected an error when no operations are given")
+	}
+
+	if _, err := ApplyFileOperations(files, []FileOperation{{Op: "copy", From: "util.go", To: "x.go"}}); err == nil {
+		t.Error("Expected an error for an unknown operation")
+	}
+
+	// the second operation refers to a file removed by the first
+	_, err := ApplyFileOperations(files, []FileOperation{
+		{Op: FileOpDelete, Path: "util.go"},
+		{Op: FileOpMove, From: "util.go", To: "lib/util.go"},
+	})
+	if err == nil {
+		t.Error("Expected an error when an operation refers to a deleted file")
+	}
+}
@@ -0,0 +1,99 @@
+package projects
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/storage"
+)
+
+// presignedURLExpiry is how long a presigned link to a build artifact stays valid, links are only handed out when
+// asked for so they are kept short
+const presignedURLExpiry = 15 * time.Minute
+
+var errArtifactNotFound = errors.New("build artifact not found")
+
+// buildArtifacts are the files written by a build which can be downloaded
+var buildArtifacts = map[string]bool{
+	"main.wasm": true,
+	"main.wat":  true,
+}
+
+// artifactURL returns the link to a build artifact served through the API
+func artifactURL(projectId, name string) string {
+	return fmt.Sprintf("%s/projects/%s/build/%s", storage.PublicURL(), projectId, name)
+}
+
+/*
+openBuildArtifact opens a build artifact of a project, returning a reader of the artifact as it is stored
+*/
+func (r *Repository) openBuildArtifact(userId, id, name string) (model.ObjectInfo, io.ReadSeekCloser, error) {
+	if !buildArtifacts[name] {
+		return model.ObjectInfo{}, nil, errArtifactNotFound
+	}
+
+	p := path.Join(getProjectWasmDir(userId, id), name)
+
+	info, err := r.storage.Stat(p)
+	if storage.IsNotFound(err) {
+		return model.ObjectInfo{}, nil, errArtifactNotFound
+	}
+
+	if err != nil {
+		return model.ObjectInfo{}, nil, err
+	}
+
+	return info, storage.NewRangeReader(r.storage, p, info.StoredSize), nil
+}
+
+func (r *Repository) genBuildPresignedURL(userId, id, name string) (string, error) {
+	if !buildArtifacts[name] {
+		return "", errArtifactNotFound
+	}
+
+	return r.storage.GenPresignedURL(path.Join(getProjectWasmDir(userId, id), name), presignedURLExpiry)
+}
+
+// OpenBuildArtifact opens a build artifact of one of a user's projects
+func (s *Service) OpenBuildArtifact(userId, projectId, name string) (model.ObjectInfo, io.ReadSeekCloser, error) {
+	proj, err := s.repo.getProjectRecord(userId, projectId)
+	if err != nil {
+		return model.ObjectInfo{}, nil, err
+	}
+
+	return s.repo.openBuildArtifact(proj.UserID, proj.ID, name)
+}
+
+// OpenSharedBuildArtifact opens a build artifact of a project which is currently shared
+func (s *Service) OpenSharedBuildArtifact(sharecode, name string) (model.ObjectInfo, io.ReadSeekCloser, error) {
+	proj, err := s.repo.getSharedProjectRecord(sharecode)
+	if err != nil {
+		return model.ObjectInfo{}, nil, err
+	}
+
+	return s.repo.openBuildArtifact(proj.UserID, proj.ID, name)
+}
+
+/*
+BuildArtifactURL returns a link to a build artifact of one of a user's projects. The link is served through the API,
+which checks the user can access the project on every request, unless a short lived presigned link is asked for.
+*/
+func (s *Service) BuildArtifactURL(userId, projectId, name string, presign bool) (string, error) {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return "", err
+	}
+
+	if presign {
+		return s.repo.genBuildPresignedURL(userId, projectId, name)
+	}
+
+	if !buildArtifacts[name] {
+		return "", errArtifactNotFound
+	}
+
+	return artifactURL(projectId, name), nil
+}
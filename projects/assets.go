@@ -0,0 +1,200 @@
+package projects
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"gorm.io/gorm"
+)
+
+// maxAssetSize is the largest file which can be uploaded as an asset
+const maxAssetSize = 10 << 20
+
+var errAssetNotFound = errors.New("asset not found")
+
+// getProjectAssetsDir returns the path to the project assets directory as held in storage
+func getProjectAssetsDir(userId string, id string) string {
+	return path.Join(getProjectDir(userId, id), "assets")
+}
+
+/*
+assetContentType works out the content type of an uploaded asset. The declared type is used when it is a valid and
+specific type, otherwise the type is guessed from the file extension and finally by sniffing the start of the file.
+The returned reader must be used in place of r as the sniffed bytes are consumed from it.
+*/
+func assetContentType(fileName, declared string, r io.Reader) (string, io.Reader, error) {
+	if mediaType, params, err := mime.ParseMediaType(declared); err == nil && mediaType != "application/octet-stream" {
+		return mime.FormatMediaType(mediaType, params), r, nil
+	}
+
+	if byExt := mime.TypeByExtension(path.Ext(fileName)); byExt != "" {
+		return byExt, r, nil
+	}
+
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", nil, err
+	}
+
+	return http.DetectContentType(head), br, nil
+}
+
+/*
+inlineAsset reports whether an asset with contentType can be displayed from the API's origin. Anything other than
+images, fonts and WASM is served as a download so that an uploaded page or SVG can't run scripts as the API.
+*/
+func inlineAsset(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "font/"):
+		return true
+	}
+
+	return mediaType == "application/wasm"
+}
+
+func (r *Repository) getAssets(projectId string) ([]model.Asset, error) {
+	var assets []model.Asset
+
+	if err := r.db.Where("project_id = ?", projectId).Order("path").Find(&assets).Error; err != nil {
+		return nil, err
+	}
+
+	return assets, nil
+}
+
+func (r *Repository) getAsset(projectId, p string) (model.Asset, error) {
+	return findAsset(r.db, projectId, p)
+}
+
+func findAsset(tx *gorm.DB, projectId, p string) (model.Asset, error) {
+	var asset model.Asset
+
+	err := tx.Where("project_id = ? AND path = ?", projectId, p).First(&asset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.Asset{}, errAssetNotFound
+	}
+
+	if err != nil {
+		return model.Asset{}, err
+	}
+
+	return asset, nil
+}
+
+/*
+uploadAsset stores an asset for a project, replacing any existing asset with the same path. The owner's storage quota
+is checked again once their usage is locked, before anything is uploaded.
+*/
+func (r *Repository) uploadAsset(
+	userId, projectId, p, contentType string,
+	size int64,
+	body io.Reader,
+) (model.Asset, error) {
+	var asset model.Asset
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		existing, err := findAsset(tx, projectId, p)
+		if err != nil && !errors.Is(err, errAssetNotFound) {
+			return err
+		}
+
+		// replacing an asset only adds the difference in size
+		if err := checkStorageWithin(tx, r.quota, userId, size-existing.Size); err != nil {
+			return err
+		}
+
+		info, err := r.storage.UploadWithContentType(
+			getProjectAssetsDir(userId, projectId), p, contentType, body,
+		)
+		if err != nil {
+			return err
+		}
+
+		if existing.ID == "" {
+			asset = model.NewAsset(projectId, p, contentType, size)
+			asset.StoredSize = info.StoredSize
+			return tx.Create(&asset).Error
+		}
+
+		asset = existing
+		asset.ContentType = contentType
+		asset.Size = size
+		asset.StoredSize = info.StoredSize
+
+		return tx.Save(&asset).Error
+	})
+
+	if err != nil {
+		return model.Asset{}, err
+	}
+
+	return asset, nil
+}
+
+func (r *Repository) openAsset(userId, projectId string, asset model.Asset) (io.ReadCloser, error) {
+	return r.storage.Get(path.Join(getProjectAssetsDir(userId, projectId), asset.Path))
+}
+
+func (r *Repository) deleteAsset(userId, projectId, p string) error {
+	asset, err := r.getAsset(projectId, p)
+	if err != nil {
+		return err
+	}
+
+	if err := r.db.Delete(&asset).Error; err != nil {
+		return err
+	}
+
+	return r.storage.Delete(path.Join(getProjectAssetsDir(userId, projectId), p))
+}
+
+// deleteProjectAssets removes the records of every asset belonging to a project, the files are removed along with
+// the rest of the project directory
+func (r *Repository) deleteProjectAssets(projectId string) error {
+	return r.db.Where("project_id = ?", projectId).Delete(&model.Asset{}).Error
+}
+
+/*
+copyAssets copies every asset from one project to another, the files are copied within storage so none of their content
+passes through the server
+*/
+func (r *Repository) copyAssets(fromUserId, fromProjectId, toUserId, toProjectId string) ([]model.Asset, error) {
+	assets, err := r.getAssets(fromProjectId)
+	if err != nil {
+		return nil, err
+	}
+
+	fromDir, toDir := getProjectAssetsDir(fromUserId, fromProjectId), getProjectAssetsDir(toUserId, toProjectId)
+
+	copied := make([]model.Asset, 0, len(assets))
+	for _, a := range assets {
+		info, err := r.storage.Copy(path.Join(fromDir, a.Path), path.Join(toDir, a.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		asset := model.NewAsset(toProjectId, a.Path, a.ContentType, a.Size)
+		asset.StoredSize = info.StoredSize
+		if err := r.db.Create(&asset).Error; err != nil {
+			return nil, err
+		}
+
+		copied = append(copied, asset)
+	}
+
+	return copied, nil
+}
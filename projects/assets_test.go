@@ -0,0 +1,63 @@
+package projects
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestAssetContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+	tests := []struct {
+		name     string
+		declared string
+		body     []byte
+		want     string
+	}{
+		{"sprite.png", "image/png", png, "image/png"},
+		{"module.wasm", "application/octet-stream", []byte("\x00asm"), "application/wasm"},
+		{"sprite", "", png, "image/png"},
+		{"data", "application/octet-stream", []byte("plain text"), "text/plain; charset=utf-8"},
+		{"page.html", "text/HTML; charset=UTF-8", []byte("<p>hi</p>"), "text/html; charset=UTF-8"},
+		{"sprite.png", "not a type", png, "image/png"},
+	}
+
+	for _, tt := range tests {
+		contentType, r, err := assetContentType(tt.name, tt.declared, bytes.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if contentType != tt.want {
+			t.Errorf("Expected %s to have content type %s, got %s", tt.name, tt.want, contentType)
+		}
+
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(body, tt.body) {
+			t.Errorf("Expected the body of %s to be unchanged after detecting its content type", tt.name)
+		}
+	}
+}
+
+func TestInlineAsset(t *testing.T) {
+	tests := map[string]bool{
+		"image/png":                true,
+		"font/woff2":               true,
+		"application/wasm":         true,
+		"image/svg+xml":            false,
+		"text/html; charset=utf-8": false,
+		"application/json":         false,
+		"not a type":               false,
+	}
+
+	for contentType, want := range tests {
+		if got := inlineAsset(contentType); got != want {
+			t.Errorf("Expected inlineAsset(%q) to be %t, got %t", contentType, want, got)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package projects
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// blobsDir is the directory in storage holding the content of every project source file
+const blobsDir = "blobs"
+
+// maxBlobWorkers is the number of blobs read from storage at once when loading a project
+const maxBlobWorkers = 16
+
+// blobGracePeriod is how long an unreferenced blob is kept before it can be reclaimed, giving saves which have
+// uploaded a blob but not yet referenced it time to finish
+const blobGracePeriod = time.Hour
+
+// blobName returns the name of a blob within the blobs directory, blobs are split into directories by the first byte
+// of their hash to keep listings small
+func blobName(hash string) string {
+	return path.Join(hash[:2], hash)
+}
+
+// getBlobPath returns the path to a blob as held in storage
+func getBlobPath(hash string) string {
+	return path.Join(blobsDir, blobName(hash))
+}
+
+/*
+putBlobs stores the content of each of the given files as a blob, returning a manifest for the files. Content which is
+already stored is not uploaded again. The blobs are not referenced until the manifest is retained.
+*/
+func (r *Repository) putBlobs(files model.ProjectFiles) (model.Manifest, error) {
+	manifest := make(model.Manifest, len(files))
+	content := make(map[string]string, len(files))
+	for p, c := range files {
+		h := model.HashContent(c)
+		manifest[p] = h
+		content[h] = c
+	}
+
+	hashes := manifest.Hashes()
+	if len(hashes) == 0 {
+		return manifest, nil
+	}
+
+	var existing []string
+	if err := r.db.Model(&model.Blob{}).Where("hash IN ?", hashes).Pluck("hash", &existing).Error; err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool, len(existing))
+	for _, h := range existing {
+		stored[h] = true
+	}
+
+	missing := make(model.ProjectFiles)
+	for _, h := range hashes {
+		if !stored[h] {
+			missing[blobName(h)] = content[h]
+		}
+	}
+
+	infos, err := r.storage.UploadFiles(blobsDir, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []model.Blob
+	for _, h := range hashes {
+		if info, ok := infos[blobName(h)]; ok {
+			rows = append(rows, model.Blob{Hash: h, Size: info.Size, StoredSize: info.StoredSize})
+		}
+	}
+
+	if len(rows) > 0 {
+		if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// touch the blobs which already existed so they aren't reclaimed before the manifest is retained
+	if len(existing) > 0 {
+		if err := r.db.Model(&model.Blob{}).Where("hash IN ?", existing).Update("updated_at", time.Now()).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, nil
+}
+
+// readBlob reads the content of a single blob
+func (r *Repository) readBlob(hash string) (string, error) {
+	body, err := r.storage.Get(getBlobPath(hash))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+/*
+readBlobs returns the files described by a manifest
+*/
+func (r *Repository) readBlobs(manifest model.Manifest) (model.ProjectFiles, error) {
+	hashes := manifest.Hashes()
+	contents := make(map[string]string, len(hashes))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var readErr error
+	sem := make(chan struct{}, maxBlobWorkers)
+
+	for _, h := range hashes {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(h string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			content, err := r.readBlob(h)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if readErr == nil {
+					readErr = err
+				}
+				return
+			}
+
+			contents[h] = content
+		}(h)
+	}
+
+	wg.Wait()
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	files := make(model.ProjectFiles, len(manifest))
+	for p, h := range manifest {
+		files[p] = contents[h]
+	}
+
+	return files, nil
+}
+
+/*
+retainBlobs adds a reference to each blob in a manifest, it must be called within the transaction which stores the
+manifest
+*/
+func retainBlobs(tx *gorm.DB, manifest model.Manifest) error {
+	hashes := manifest.Hashes()
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	res := tx.Model(&model.Blob{}).
+		Where("hash IN ?", hashes).
+		UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	// a blob can only be missing if it was reclaimed between being uploaded and being retained
+	if res.RowsAffected != int64(len(hashes)) {
+		return fmt.Errorf("%d blobs were reclaimed before they could be referenced", int64(len(hashes))-res.RowsAffected)
+	}
+
+	return nil
+}
+
+/*
+releaseBlobs removes a reference from each blob in a manifest, it must be called within the transaction which removes
+or replaces the manifest
+*/
+func releaseBlobs(tx *gorm.DB, manifest model.Manifest) error {
+	hashes := manifest.Hashes()
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	return tx.Model(&model.Blob{}).
+		Where("hash IN ?", hashes).
+		UpdateColumn("ref_count", gorm.Expr("ref_count - 1")).Error
+}
+
+/*
+replaceManifest stores a new manifest for a project, moving the references held by the old manifest to the new one
+*/
+func replaceManifest(tx *gorm.DB, project *model.Project, manifest model.Manifest) error {
+	if err := retainBlobs(tx, manifest); err != nil {
+		return err
+	}
+
+	if err := releaseBlobs(tx, project.Manifest); err != nil {
+		return err
+	}
+
+	if err := tx.Model(project).Update("manifest", manifest).Error; err != nil {
+		return err
+	}
+
+	project.Manifest = manifest
+	return nil
+}
+
+/*
+reclaimBlobs deletes every blob which is no longer referenced by any manifest and has passed the grace period,
+returning the number of blobs deleted. Each blob's object is deleted while its row is still locked, so a save can't
+find the row and skip uploading content which is about to be deleted.
+*/
+func (r *Repository) reclaimBlobs() (int, error) {
+	var candidates []string
+	if err := r.db.Model(&model.Blob{}).
+		Where("ref_count <= 0 AND updated_at < ?", time.Now().Add(-blobGracePeriod)).
+		Pluck("hash", &candidates).Error; err != nil {
+		return 0, err
+	}
+
+	reclaimed := 0
+	for _, hash := range candidates {
+		deleted := false
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			var blobs []model.Blob
+			// the blob may have been referenced or touched since it was listed
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("hash = ? AND ref_count <= 0 AND updated_at < ?", hash, time.Now().Add(-blobGracePeriod)).
+				Find(&blobs).Error; err != nil {
+				return err
+			}
+
+			if len(blobs) == 0 {
+				return nil
+			}
+
+			if err := r.storage.Delete(getBlobPath(hash)); err != nil {
+				return err
+			}
+
+			deleted = true
+			return tx.Delete(&blobs).Error
+		})
+
+		if err != nil {
+			return reclaimed, err
+		}
+
+		if deleted {
+			reclaimed++
+		}
+	}
+
+	return reclaimed, nil
+}
@@ -0,0 +1,330 @@
+package projects
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/wasm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultBuildCacheSize is the most bytes the build cache holds in storage unless set in the environment
+const defaultBuildCacheSize = 1 << 30
+
+// buildCacheDir is the directory in storage holding the artifacts of cached builds, under the key of each build
+const buildCacheDir = "builds"
+
+func getBuildCacheDir(key string) string {
+	return path.Join(buildCacheDir, key)
+}
+
+// buildCacheSizeFromEnv reads the size of the build cache from the environment, a size of 0 turns the cache off
+func buildCacheSizeFromEnv() int64 {
+	return envInt(env.OPT_BUILD_CACHE_SIZE, defaultBuildCacheSize)
+}
+
+func (r *Repository) getBuildCacheEntry(key string) (model.BuildCacheEntry, bool, error) {
+	var entry model.BuildCacheEntry
+
+	err := r.db.Where("key = ?", key).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.BuildCacheEntry{}, false, nil
+	}
+
+	if err != nil {
+		return model.BuildCacheEntry{}, false, err
+	}
+
+	return entry, true, nil
+}
+
+// touchBuildCacheEntry records that a cached build has been used, keeping it from being evicted for longer
+func (r *Repository) touchBuildCacheEntry(key string) error {
+	return r.db.Model(&model.BuildCacheEntry{}).Where("key = ?", key).Updates(map[string]interface{}{
+		"hits":         gorm.Expr("hits + 1"),
+		"last_used_at": time.Now(),
+	}).Error
+}
+
+// addBuildCacheEntry adds a build to the cache, a build which is already cached is left as it is
+func addBuildCacheEntry(tx *gorm.DB, entry *model.BuildCacheEntry) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entry).Error
+}
+
+func (r *Repository) deleteBuildCacheEntry(key string) error {
+	return r.db.Where("key = ?", key).Delete(&model.BuildCacheEntry{}).Error
+}
+
+// copyBuildArtifacts copies the named artifacts from one directory in storage to another, returning the total size
+func (r *Repository) copyBuildArtifacts(src, dest string, artifacts model.JobArtifacts) (sizes, error) {
+	var total sizes
+
+	for name := range artifacts {
+		info, err := r.storage.Copy(path.Join(src, name), path.Join(dest, name))
+		if err != nil {
+			return sizes{}, err
+		}
+
+		total.Size += info.Size
+		total.StoredSize += info.StoredSize
+	}
+
+	return total, nil
+}
+
+// lockBuildCacheKey holds a key of the build cache until tx ends, so a build isn't evicted while it is being cached
+func lockBuildCacheKey(tx *gorm.DB, key string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "build:"+key).Error
+}
+
+/*
+evictBuildCache removes the least recently used builds from the cache until what is left takes up at most maxSize
+bytes, returning the number of builds removed. Each build is removed while its key is locked, so the artifacts of a
+build cached again since it was chosen are never deleted.
+*/
+func (r *Repository) evictBuildCache(maxSize int64) (int, error) {
+	var entries []model.BuildCacheEntry
+	err := r.db.Select("key", "stored_size", "last_used_at").Order("last_used_at DESC").Find(&entries).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	var evict []model.BuildCacheEntry
+	for _, e := range entries {
+		total += e.StoredSize
+		if total > maxSize {
+			evict = append(evict, e)
+		}
+	}
+
+	evicted := 0
+	for _, e := range evict {
+		removed := false
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			if err := lockBuildCacheKey(tx, e.Key); err != nil {
+				return err
+			}
+
+			// a build which has been used or cached again since it was chosen is kept
+			var current []model.BuildCacheEntry
+			if err := tx.Where("key = ? AND last_used_at <= ?", e.Key, e.LastUsedAt).Find(&current).Error; err != nil {
+				return err
+			}
+
+			if len(current) == 0 {
+				return nil
+			}
+
+			// the row goes first so that a build is never used once its artifacts have started to be deleted
+			if err := tx.Where("key = ?", e.Key).Delete(&model.BuildCacheEntry{}).Error; err != nil {
+				return err
+			}
+
+			if err := r.storage.DeleteDir(getBuildCacheDir(e.Key)); err != nil {
+				return err
+			}
+
+			removed = true
+			return nil
+		})
+
+		if err != nil {
+			log.Printf("[projects] Error evicting build %s: %v", e.Key, err)
+			continue
+		}
+
+		if removed {
+			evicted++
+		}
+	}
+
+	return evicted, nil
+}
+
+/*
+buildCacheKey returns the key a build of files would be cached under, or an empty key when the build can't be cached
+because the cache is turned off or the version of the toolchain can't be found
+*/
+func (s *Service) buildCacheKey(language model.ProjectLanguage, files model.ProjectFiles, opts wasm.CompileOpts) string {
+	if s.buildCacheSize == 0 {
+		return ""
+	}
+
+	key, err := wasm.BuildKey(language, files, opts)
+	if err != nil {
+		log.Printf("[projects] Not caching build: %v", err)
+		return ""
+	}
+
+	return key
+}
+
+/*
+useCachedBuild copies the artifacts of a cached build to the project of a job, reporting whether the build was cached.
+A build which is cached but can't be copied, because it was evicted part way through, is removed from the cache so that
+it is cached again once it has been compiled.
+*/
+func (s *Service) useCachedBuild(job *model.CompileJob, key string) (bool, error) {
+	entry, ok, err := s.repo.getBuildCacheEntry(key)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := s.repo.reserveBuild(job.ProjectID, job.Revision); err != nil {
+		return true, err
+	}
+
+	size, err := s.repo.copyBuildArtifacts(
+		getBuildCacheDir(key),
+		getProjectWasmDir(job.UserID, job.ProjectID),
+		entry.Artifacts,
+	)
+	if err != nil {
+		if err := s.repo.deleteBuildCacheEntry(key); err != nil {
+			log.Printf("[projects] Error removing build %s from the cache: %v", key, err)
+		}
+
+		return false, err
+	}
+
+	if err := s.repo.touchBuildCacheEntry(key); err != nil {
+		log.Printf("[projects] Error recording a hit on cached build %s: %v", key, err)
+	}
+
+	job.Artifacts = entry.Artifacts
+	job.Diagnostics = entry.Diagnostics
+	job.CacheHit = true
+	job.Toolchain = entry.Toolchain
+
+	return true, s.repo.setBuildSize(job.ProjectID, size.Size, size.StoredSize)
+}
+
+/*
+uploadBuildArtifacts uploads the artifacts of a compile to a directory in storage, returning the artifacts written along
+with their total size
+*/
+func (r *Repository) uploadBuildArtifacts(dir string, res wasm.CompileResult) (model.JobArtifacts, sizes, error) {
+	var wg sync.WaitGroup
+	var wasmInfo, watInfo model.ObjectInfo
+	var wasmErr, watErr error
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		wasmInfo, wasmErr = r.storage.Upload(dir, "main.wasm", bytes.NewReader(res.Wasm))
+	}()
+
+	go func() {
+		defer wg.Done()
+		watInfo, watErr = r.storage.Upload(dir, "main.wat", strings.NewReader(res.Wat))
+	}()
+
+	wg.Wait()
+
+	if wasmErr != nil {
+		return nil, sizes{}, wasmErr
+	}
+
+	if watErr != nil {
+		return nil, sizes{}, watErr
+	}
+
+	artifacts := model.JobArtifacts{
+		"main.wasm": wasmInfo.Size,
+		"main.wat":  watInfo.Size,
+	}
+
+	return artifacts, sizes{
+		Size:       wasmInfo.Size + watInfo.Size,
+		StoredSize: wasmInfo.StoredSize + watInfo.StoredSize,
+	}, nil
+}
+
+/*
+storeBuild writes the artifacts a job compiled to its project, returning the artifacts along with their size in the
+project. When the build can be cached the artifacts are uploaded to the cache under key and copied from there to the
+project, so the cache only ever holds what the job itself compiled and never what another job has since written to
+the project. A build which can't be cached, or whose cached copy can't be used, is uploaded straight to the project.
+*/
+func (s *Service) storeBuild(
+	job *model.CompileJob,
+	key string,
+	res wasm.CompileResult,
+) (model.JobArtifacts, sizes, error) {
+	projectDir := getProjectWasmDir(job.UserID, job.ProjectID)
+
+	if key != "" {
+		artifacts, err := s.cacheBuild(job, key, res)
+
+		var size sizes
+		if err == nil {
+			size, err = s.repo.copyBuildArtifacts(getBuildCacheDir(key), projectDir, artifacts)
+		}
+
+		// the cache is only trimmed once the build has been copied out of it
+		if err == nil {
+			s.trimBuildCache()
+			return artifacts, size, nil
+		}
+
+		log.Printf("[projects] Error caching build %s, uploading it to the project instead: %v", key, err)
+	}
+
+	return s.repo.uploadBuildArtifacts(projectDir, res)
+}
+
+/*
+cacheBuild uploads the artifacts a job compiled to the cache under key and records them as a cached build. The key is
+locked from the upload until the build is recorded, so an eviction of an earlier build under the same key can't delete
+the artifacts once they have been uploaded.
+*/
+func (s *Service) cacheBuild(job *model.CompileJob, key string, res wasm.CompileResult) (model.JobArtifacts, error) {
+	var artifacts model.JobArtifacts
+
+	err := s.repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockBuildCacheKey(tx, key); err != nil {
+			return err
+		}
+
+		var size sizes
+		var err error
+		artifacts, size, err = s.repo.uploadBuildArtifacts(getBuildCacheDir(key), res)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return addBuildCacheEntry(tx, &model.BuildCacheEntry{
+			Key:         key,
+			Artifacts:   artifacts,
+			Diagnostics: job.Diagnostics,
+			Toolchain:   job.Toolchain,
+			StoredSize:  size.StoredSize,
+			CreatedAt:   now,
+			LastUsedAt:  now,
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
+
+// trimBuildCache evicts the least recently used builds until the cache fits in its size
+func (s *Service) trimBuildCache() {
+	if _, err := s.repo.evictBuildCache(s.buildCacheSize); err != nil {
+		log.Printf("[projects] Error evicting builds from the cache: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package projects
+
+import (
+	"io"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/storage"
+	"github.com/sammyhass/web-ide/server/wasm"
+)
+
+// uploadHook runs before once, before anything is uploaded to dir, holding back every upload to dir until it returns
+type uploadHook struct {
+	storage.Backend
+	dir    string
+	once   sync.Once
+	before func()
+}
+
+func (h *uploadHook) Upload(dir, fileName string, r io.Reader) (model.ObjectInfo, error) {
+	if dir == h.dir {
+		h.once.Do(h.before)
+	}
+
+	return h.Backend.Upload(dir, fileName, r)
+}
+
+func readStored(t *testing.T, b storage.Backend, p string) string {
+	t.Helper()
+
+	rc, err := b.Get(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestBuildArtifactsFinishingOutOfOrder(t *testing.T) {
+	l := storage.NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+	projectDir := getProjectWasmDir("user", "project")
+
+	older := wasm.CompileResult{Wasm: []byte("older wasm"), Wat: "(module) ;; older"}
+	newer := wasm.CompileResult{Wasm: []byte("newer wasm"), Wat: "(module) ;; newer"}
+
+	// the newer job finishes while the older job is still writing its artifacts
+	r := &Repository{storage: l}
+	r.storage = &uploadHook{Backend: l, dir: getBuildCacheDir("older"), before: func() {
+		// this runs within an upload of the older build, so failures can't stop the test here
+		artifacts, _, err := r.uploadBuildArtifacts(getBuildCacheDir("newer"), newer)
+		if err == nil {
+			_, err = r.copyBuildArtifacts(getBuildCacheDir("newer"), projectDir, artifacts)
+		}
+		if err != nil {
+			t.Errorf("Expected the newer build to be stored, got %v", err)
+		}
+	}}
+
+	if _, _, err := r.uploadBuildArtifacts(getBuildCacheDir("older"), older); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, res := range map[string]wasm.CompileResult{"older": older, "newer": newer} {
+		if got := readStored(t, l, path.Join(getBuildCacheDir(key), "main.wasm")); got != string(res.Wasm) {
+			t.Errorf("Expected the %s build to be cached with its own wasm, got %q", key, got)
+		}
+
+		if got := readStored(t, l, path.Join(getBuildCacheDir(key), "main.wat")); got != res.Wat {
+			t.Errorf("Expected the %s build to be cached with its own wat, got %q", key, got)
+		}
+	}
+
+	if got := readStored(t, l, path.Join(projectDir, "main.wasm")); got != string(newer.Wasm) {
+		t.Errorf("Expected the project to hold the newer build, got %q", got)
+	}
+}
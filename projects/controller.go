@@ -1,8 +1,20 @@
 package projects
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"github.com/sammyhass/web-ide/server/auth"
+	"github.com/sammyhass/web-ide/server/compress"
 	"github.com/sammyhass/web-ide/server/model"
 )
 
@@ -25,13 +37,33 @@ func (c *controller) Routes(
 	group.GET("/:id", auth.Protected(c.getProject))
 	group.DELETE("/:id", auth.Protected(c.deleteProject))
 	group.PATCH("/:id", auth.Protected(c.updateProject))
+	group.GET("/:id/tree", auth.Protected(c.getProjectTree))
+	group.PATCH("/:id/move", auth.Protected(c.moveProjectFiles))
+	group.POST("/:id/files/batch", auth.Protected(c.applyFileOperations))
+	group.DELETE("/:id/files/*path", auth.Protected(c.deleteProjectFiles))
+	group.GET("/:id/assets", auth.Protected(c.getAssets))
+	group.POST("/:id/assets", auth.Protected(c.uploadAsset))
+	group.GET("/:id/assets/*path", auth.Protected(c.downloadAsset))
+	group.DELETE("/:id/assets/*path", auth.Protected(c.deleteAsset))
 	group.POST("/:id/compile", auth.Protected(c.compileProjectToWasm))
+	group.GET("/:id/jobs", auth.Protected(c.getCompileJobs))
+	group.GET("/:id/jobs/:job", auth.Protected(c.getCompileJob))
+	group.GET("/:id/jobs/:job/log", protectedJobLog(c.streamCompileJobLog))
 	group.GET("/:id/wat", auth.Protected(c.getProjectWat))
+	group.GET("/:id/build/:file", auth.Protected(c.getBuildArtifact))
 	group.PATCH("/:id/rename", auth.Protected(c.renameProject))
+	group.GET("/:id/settings", auth.Protected(c.getBuildSettings))
+	group.PUT("/:id/settings", auth.Protected(c.updateBuildSettings))
+	group.POST("/:id/upgrade", auth.Protected(c.upgradeCompiler))
 	group.PATCH("/:id/share", auth.Protected(c.toggleShareProject))
+	group.POST("/:id/duplicate", auth.Protected(c.duplicateProject))
+	group.GET("/:id/revisions", auth.Protected(c.getRevisions))
+	group.GET("/:id/revisions/diff", auth.Protected(c.diffRevisions))
+	group.POST("/:id/revisions/:number/restore", auth.Protected(c.restoreRevision))
 
 	group.POST("/fork/:code", auth.Protected(c.forkProject))
 	group.GET("/fork/:code", c.getSharedProject)
+	group.GET("/fork/:code/build/:file", c.getSharedBuildArtifact)
 }
 
 type newProjectDto struct {
@@ -85,6 +117,7 @@ func (c *controller) getProject(
 		return
 	}
 
+	ctx.Header("ETag", revisionETag(project.Revision))
 	ctx.JSON(200, project)
 }
 
@@ -102,7 +135,20 @@ func (c *controller) deleteProject(
 }
 
 type updateProjectFilesDto struct {
-	Files model.ProjectFiles `json:"files"`
+	Files    model.ProjectFiles `json:"files"`
+	Message  string             `json:"message"`  // Message optionally describes the revision created by the update
+	Revision *int               `json:"revision"` // Revision is the revision the update is based on, if not given by If-Match
+}
+
+// revisionETag returns the ETag identifying a revision of a project
+func revisionETag(revision int) string {
+	return fmt.Sprintf(`"%d"`, revision)
+}
+
+// parseRevisionETag returns the revision identified by an ETag given in an If-Match header
+func parseRevisionETag(tag string) (int, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	return strconv.Atoi(strings.Trim(tag, `"`))
 }
 
 func (c *controller) updateProject(
@@ -116,41 +162,355 @@ func (c *controller) updateProject(
 		return
 	}
 
-	_, err := c.service.UpdateProjectFiles(
+	revision, ok := requestRevision(ctx, dto.Revision)
+	if !ok {
+		return
+	}
+
+	if revision == nil {
+		ctx.JSON(http.StatusPreconditionRequired, gin.H{
+			"error": "the revision being updated must be given with If-Match or in the request body",
+		})
+		return
+	}
+
+	rev, files, err := c.service.UpdateProjectFiles(
 		uuid,
 		ctx.Param("id"),
 		dto.Files,
+		dto.Message,
+		*revision,
 	)
 
+	if writeConflict(ctx, err) {
+		return
+	}
+
 	if err != nil {
 		ctx.Error(err)
 		return
 	}
 
+	ctx.Header("ETag", revisionETag(rev.Number))
 	ctx.JSON(200,
-		model.ProjectFilesToFileViews(dto.Files),
+		model.ProjectFilesToFileViews(files),
 	)
 }
 
+/*
+requestRevision returns the revision a request is based on, given either by an If-Match header or in the body. It
+responds with an error and returns false if the If-Match header is invalid.
+*/
+func requestRevision(ctx *gin.Context, body *int) (*int, bool) {
+	tag := ctx.GetHeader("If-Match")
+	if tag == "" {
+		return body, true
+	}
+
+	rev, err := parseRevisionETag(tag)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match header"})
+		return nil, false
+	}
+
+	return &rev, true
+}
+
+// writeConflict responds with the files which conflict with a stale save, returning false if err isn't a conflict
+func writeConflict(ctx *gin.Context, err error) bool {
+	var conflict *conflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+
+	ctx.Header("ETag", revisionETag(conflict.Revision))
+	ctx.JSON(http.StatusConflict, gin.H{
+		"error":    conflict.Error(),
+		"revision": conflict.Revision,
+		"files":    model.ProjectFilesToFileViews(conflict.Files),
+	})
+
+	return true
+}
+
+func (c *controller) getProjectTree(
+	ctx *gin.Context,
+	uuid string,
+) {
+	tree, err := c.service.GetProjectTree(uuid, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, tree)
+}
+
+type moveProjectFilesDto struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Revision *int   `json:"revision"` // Revision is the revision the move is based on, if not given by If-Match
+}
+
+/*
+moveProjectFiles moves or renames a single file or a whole directory, returning every file in the project. The move is
+checked against the head of the project when a revision is given.
+*/
+func (c *controller) moveProjectFiles(
+	ctx *gin.Context,
+	uuid string,
+) {
+	var dto moveProjectFilesDto
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	revision, ok := requestRevision(ctx, dto.Revision)
+	if !ok {
+		return
+	}
+
+	rev, files, err := c.service.MoveProjectFiles(uuid, ctx.Param("id"), dto.From, dto.To, revision)
+	if writeConflict(ctx, err) {
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("ETag", revisionETag(rev.Number))
+	ctx.JSON(200, model.ProjectFilesToFileViews(files))
+}
+
+/*
+deleteProjectFiles deletes a single file or a whole directory, returning every file left in the project. The deletion
+is checked against the head of the project when If-Match is given.
+*/
+func (c *controller) deleteProjectFiles(
+	ctx *gin.Context,
+	uuid string,
+) {
+	revision, ok := requestRevision(ctx, nil)
+	if !ok {
+		return
+	}
+
+	path := strings.TrimPrefix(ctx.Param("path"), "/")
+
+	rev, files, err := c.service.DeleteProjectFiles(uuid, ctx.Param("id"), path, revision)
+	if writeConflict(ctx, err) {
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("ETag", revisionETag(rev.Number))
+	ctx.JSON(200, model.ProjectFilesToFileViews(files))
+}
+
+type fileOperationsDto struct {
+	Operations []model.FileOperation `json:"operations"`
+	Message    string                `json:"message"`  // Message optionally describes the revision created by the operations
+	Revision   *int                  `json:"revision"` // Revision is the revision the operations are based on, if not given by If-Match
+}
+
+/*
+applyFileOperations deletes, renames and moves files as a single revision, returning every file in the project once
+all of the operations have been applied
+*/
+func (c *controller) applyFileOperations(
+	ctx *gin.Context,
+	uuid string,
+) {
+	var dto fileOperationsDto
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	revision, ok := requestRevision(ctx, dto.Revision)
+	if !ok {
+		return
+	}
+
+	rev, files, err := c.service.ApplyFileOperations(uuid, ctx.Param("id"), dto.Operations, dto.Message, revision)
+	if writeConflict(ctx, err) {
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("ETag", revisionETag(rev.Number))
+	ctx.JSON(200, model.ProjectFilesToFileViews(files))
+}
+
 func (c *controller) compileProjectToWasm(
 	ctx *gin.Context,
 	uuid string,
 ) {
-	path, err := c.service.CompileProjectWASM(uuid, ctx.Param("id"))
+	id := ctx.Param("id")
 
+	job, err := c.service.CompileProject(uuid, id)
 	if err != nil {
 		ctx.Error(err)
 		return
 	}
 
-	ctx.JSON(200, path)
+	if ctx.Query("wait") == "true" {
+		job, err = c.service.WaitForCompileJob(ctx.Request.Context(), uuid, id, job.ID, ctx.Query("presign") == "true")
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+	}
+
+	ctx.Header("Location", jobURL(id, job.ID))
+
+	if !job.Status.Finished() {
+		ctx.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	// a build which failed because of the project's code responds with the compiler's diagnostics, anything else which
+	// went wrong is an error of the server
+	if job.Status == model.JobFailed {
+		if len(job.Diagnostics) == 0 {
+			ctx.Error(errors.New(job.Error))
+			return
+		}
+
+		ctx.JSON(http.StatusUnprocessableEntity, job)
+		return
+	}
+
+	ctx.JSON(200, job)
+}
+
+func (c *controller) getCompileJobs(
+	ctx *gin.Context,
+	uuid string,
+) {
+	jobs, err := c.service.GetCompileJobs(uuid, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, jobs)
+}
+
+func (c *controller) getCompileJob(
+	ctx *gin.Context,
+	uuid string,
+) {
+	job, err := c.service.GetCompileJob(uuid, ctx.Param("id"), ctx.Param("job"), ctx.Query("presign") == "true")
+	if err == errJobNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, job)
+}
+
+/*
+protectedJobLog lets the log of a job be followed with the Authorization header like the rest of the API, or with the
+signed link given as the job's log_url, since EventSource can't send headers
+*/
+func protectedJobLog(handler func(ctx *gin.Context, userID string)) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		if userID, err := auth.GetUserFromContext(ctx); err == nil {
+			handler(ctx, userID)
+			return
+		}
+
+		userID, err := verifyJobLogURL(ctx.Param("job"), ctx.Request.URL.Query())
+		if err != nil {
+			ctx.AbortWithError(http.StatusUnauthorized, err)
+			return
+		}
+
+		handler(ctx, userID)
+	}
+}
+
+/*
+streamCompileJobLog streams the log of a compile job as server-sent events, each with the number of the entry as its id
+so that a client which reconnects with Last-Event-ID carries on where it left off. A job which has finished with
+nothing more to send responds with 204 No Content, which stops browsers reconnecting.
+*/
+func (c *controller) streamCompileJobLog(
+	ctx *gin.Context,
+	uuid string,
+) {
+	after := 0
+	if last := ctx.GetHeader("Last-Event-ID"); last != "" {
+		after, _ = strconv.Atoi(last)
+	} else if q := ctx.Query("after"); q != "" {
+		after, _ = strconv.Atoi(q)
+	}
+
+	streaming := false
+	finished, err := c.service.FollowCompileJobLog(
+		ctx.Request.Context(),
+		uuid, ctx.Param("id"), ctx.Param("job"),
+		after,
+		func(entry model.CompileJobLogView) error {
+			if !streaming {
+				streaming = true
+				ctx.Header("Cache-Control", "no-cache")
+				// stops proxies such as nginx holding back events until the response finishes
+				ctx.Header("X-Accel-Buffering", "no")
+			}
+
+			ctx.Render(-1, sse.Event{
+				Id:    strconv.Itoa(entry.Seq),
+				Event: string(entry.Event),
+				Data:  entry,
+			})
+			ctx.Writer.Flush()
+
+			return nil
+		},
+	)
+
+	switch {
+	case streaming && err != nil:
+		ctx.Render(-1, sse.Event{Event: "error", Data: gin.H{"error": err.Error()}})
+	case err == errJobNotFound:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		ctx.Error(err)
+	case !streaming && finished:
+		ctx.Status(http.StatusNoContent)
+	case !streaming:
+		// the job hasn't logged anything yet, the client reconnects to keep waiting
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("Content-Type", "text/event-stream")
+		ctx.Status(200)
+	}
 }
 
 func (c *controller) getProjectWat(
 	ctx *gin.Context,
 	uuid string,
 ) {
-	wat, err := c.service.GenProjectWatPresignedURL(uuid, ctx.Param("id"))
+	wat, err := c.service.BuildArtifactURL(uuid, ctx.Param("id"), "main.wat", ctx.Query("presign") == "true")
 
 	if err != nil {
 		ctx.Error(err)
@@ -185,6 +545,66 @@ func (c *controller) renameProject(
 	}
 }
 
+func (c *controller) getBuildSettings(
+	ctx *gin.Context,
+	uuid string,
+) {
+	settings, err := c.service.GetBuildSettings(uuid, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, settings)
+}
+
+// updateBuildSettings replaces the build settings of a project, settings left out of the body go back to their defaults
+func (c *controller) updateBuildSettings(
+	ctx *gin.Context,
+	uuid string,
+) {
+	var dto model.BuildSettings
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	settings, err := c.service.UpdateBuildSettings(uuid, ctx.Param("id"), dto)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, settings)
+}
+
+/*
+upgradeCompiler pins a project to the version of the compiler given in the body, a request without a body or version
+pins the project to the default version
+*/
+func (c *controller) upgradeCompiler(
+	ctx *gin.Context,
+	uuid string,
+) {
+	var dto struct {
+		Version string `json:"version"`
+	}
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil && err != io.EOF {
+		ctx.Error(err)
+		return
+	}
+
+	p, err := c.service.UpgradeCompiler(uuid, ctx.Param("id"), dto.Version)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, p)
+}
+
 // create a share code by which a project can be forked by another user
 // returns the share code if the project is now shareable, else returns false
 func (c *controller) toggleShareProject(
@@ -238,6 +658,19 @@ func (c *controller) forkProject(
 	ctx.JSON(200, proj)
 }
 
+func (c *controller) duplicateProject(
+	ctx *gin.Context,
+	uuid string,
+) {
+	proj, err := c.service.DuplicateProject(uuid, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, proj)
+}
+
 func (c *controller) getSharedProject(
 	ctx *gin.Context,
 ) {
@@ -250,3 +683,298 @@ func (c *controller) getSharedProject(
 	}
 	ctx.JSON(200, project)
 }
+
+func (c *controller) getAssets(
+	ctx *gin.Context,
+	uuid string,
+) {
+	assets, err := c.service.GetAssets(uuid, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, assets)
+}
+
+// uploadAsset accepts a multipart form with the asset in the "file" field, the asset is stored at the path given in
+// the "path" field or under its original file name
+func (c *controller) uploadAsset(
+	ctx *gin.Context,
+	uuid string,
+) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxAssetSize+1<<20)
+
+	fh, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if fh.Size > maxAssetSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("assets must be smaller than %d bytes", maxAssetSize),
+		})
+		return
+	}
+
+	assetPath := ctx.PostForm("path")
+	if assetPath == "" {
+		assetPath = fh.Filename
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	defer f.Close()
+
+	contentType, body, err := assetContentType(assetPath, fh.Header.Get("Content-Type"), f)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	asset, err := c.service.UploadAsset(uuid, ctx.Param("id"), assetPath, contentType, fh.Size, body)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, asset)
+}
+
+func (c *controller) downloadAsset(
+	ctx *gin.Context,
+	uuid string,
+) {
+	asset, body, err := c.service.OpenAsset(uuid, ctx.Param("id"), strings.TrimPrefix(ctx.Param("path"), "/"))
+	if err == errAssetNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	defer body.Close()
+
+	headers := map[string]string{"X-Content-Type-Options": "nosniff"}
+	if !inlineAsset(asset.ContentType) {
+		headers["Content-Disposition"] = mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(asset.Path)})
+	}
+
+	ctx.DataFromReader(200, asset.Size, asset.ContentType, body, headers)
+}
+
+func (c *controller) deleteAsset(
+	ctx *gin.Context,
+	uuid string,
+) {
+	if err := c.service.DeleteAsset(uuid, ctx.Param("id"), strings.TrimPrefix(ctx.Param("path"), "/")); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, gin.H{})
+}
+
+func (c *controller) getRevisions(
+	ctx *gin.Context,
+	uuid string,
+) {
+	revisions, err := c.service.GetRevisions(uuid, ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, revisions)
+}
+
+// diffRevisions returns a unified diff between the revisions given in the from and to query parameters, by default
+// the head revision is compared with the one before it, which for the first revision is the empty project
+func (c *controller) diffRevisions(
+	ctx *gin.Context,
+	uuid string,
+) {
+	var query struct {
+		From int `form:"from"`
+		To   int `form:"to"`
+	}
+
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	d, err := c.service.DiffRevisions(uuid, ctx.Param("id"), query.From, query.To)
+	if err == errRevisionNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, d)
+}
+
+// restoreRevision restores a past revision as the new head, the restore is checked against the head when If-Match is given
+func (c *controller) restoreRevision(
+	ctx *gin.Context,
+	uuid string,
+) {
+	number, err := strconv.Atoi(ctx.Param("number"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	revision, ok := requestRevision(ctx, nil)
+	if !ok {
+		return
+	}
+
+	rev, files, err := c.service.RestoreRevision(uuid, ctx.Param("id"), number, revision)
+	if err == errRevisionNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if writeConflict(ctx, err) {
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("ETag", revisionETag(rev.Number))
+
+	ctx.JSON(200, gin.H{
+		"revision": rev,
+		"files":    files,
+	})
+}
+
+// usageController reports how much the signed in user is storing
+type usageController struct {
+	service *Service
+}
+
+func NewUsageController() *usageController {
+	return &usageController{
+		service: NewService(),
+	}
+}
+
+func (c *usageController) Routes(
+	group *gin.RouterGroup,
+) {
+	group.GET("/usage", auth.Protected(c.getUsage))
+}
+
+func (c *usageController) getUsage(
+	ctx *gin.Context,
+	uuid string,
+) {
+	usage, err := c.service.GetUsage(uuid)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.JSON(200, usage)
+}
+
+func (c *controller) getBuildArtifact(
+	ctx *gin.Context,
+	uuid string,
+) {
+	name := ctx.Param("file")
+
+	info, content, err := c.service.OpenBuildArtifact(uuid, ctx.Param("id"), name)
+	serveArtifact(ctx, name, info, content, err)
+}
+
+func (c *controller) getSharedBuildArtifact(
+	ctx *gin.Context,
+) {
+	name := ctx.Param("file")
+
+	info, content, err := c.service.OpenSharedBuildArtifact(ctx.Param("code"), name)
+	serveArtifact(ctx, name, info, content, err)
+}
+
+/*
+serveArtifact streams a build artifact to the client, handling Range and If-None-Match requests. Compressed artifacts
+are sent compressed to clients which accept gzip and decompressed for any others.
+*/
+func serveArtifact(ctx *gin.Context, name string, info model.ObjectInfo, content io.ReadSeekCloser, err error) {
+	if err == errArtifactNotFound {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	defer content.Close()
+
+	var body io.ReadSeeker = content
+	etag := info.ETag
+
+	if info.ContentEncoding != "" {
+		ctx.Header("Vary", "Accept-Encoding")
+
+		if acceptsEncoding(ctx.GetHeader("Accept-Encoding"), info.ContentEncoding) {
+			ctx.Header("Content-Encoding", info.ContentEncoding)
+			etag += "-" + info.ContentEncoding
+		} else {
+			decoded, err := compress.Decode(info.ContentEncoding, content)
+			if err != nil {
+				ctx.Error(err)
+				return
+			}
+
+			b, err := io.ReadAll(decoded)
+			if err != nil {
+				ctx.Error(err)
+				return
+			}
+			body = bytes.NewReader(b)
+		}
+	}
+
+	if info.ContentType == "" {
+		info.ContentType = compress.ContentType(name)
+	}
+
+	ctx.Header("Content-Type", info.ContentType)
+	ctx.Header("ETag", fmt.Sprintf(`"%s"`, etag))
+	ctx.Header("Cache-Control", "private, no-cache")
+
+	http.ServeContent(ctx.Writer, ctx.Request, name, info.ModTime, body)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows responses with the given encoding
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if coding != encoding && coding != "*" {
+			continue
+		}
+
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+
+	return false
+}
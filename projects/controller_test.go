@@ -0,0 +1,121 @@
+package projects
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sammyhass/web-ide/server/storage"
+)
+
+func TestParseRevisionETag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want int
+	}{
+		{revisionETag(3), 3},
+		{`W/"12"`, 12},
+		{" \"0\" ", 0},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRevisionETag(tt.tag)
+		if err != nil {
+			t.Fatalf("Expected %s to parse, got %v", tt.tag, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("Expected %s to be revision %d, got %d", tt.tag, tt.want, got)
+		}
+	}
+
+	if _, err := parseRevisionETag(`"abc"`); err == nil {
+		t.Error("Expected an ETag which isn't a revision to be rejected")
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"gzip, deflate, br", true},
+		{"br;q=1.0, gzip;q=0.8", true},
+		{"*", true},
+		{"gzip;q=0", false},
+		{"identity", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsEncoding(tt.header, "gzip"); got != tt.want {
+			t.Errorf("Expected acceptsEncoding(%q) to be %v, got %v", tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestServeArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	l := storage.NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+	wat := strings.Repeat("(module (func $main))\n", 100)
+
+	if _, err := l.Upload("user/project/build", "main.wat", strings.NewReader(wat)); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		info, err := l.Stat("user/project/build/main.wat")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/projects/project/build/main.wat", nil)
+		for k, v := range headers {
+			ctx.Request.Header.Set(k, v)
+		}
+
+		serveArtifact(ctx, "main.wat", info, storage.NewRangeReader(l, "user/project/build/main.wat", info.StoredSize), nil)
+		ctx.Writer.WriteHeaderNow()
+		return w
+	}
+
+	w := serve(map[string]string{"Accept-Encoding": "gzip"})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip response, got %d %v", w.Code, w.Header())
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != wat {
+		t.Error("Expected the compressed response to decompress to the artifact")
+	}
+
+	etag := w.Header().Get("ETag")
+	if w := serve(map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected a matching ETag to return 304, got %d", w.Code)
+	}
+
+	w = serve(map[string]string{"Range": "bytes=0-6"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != wat[:7] {
+		t.Errorf("Expected the first 7 bytes of the artifact, got %d %q", w.Code, w.Body.String())
+	}
+
+	if w.Header().Get("ETag") == etag {
+		t.Error("Expected the compressed and decompressed artifact to have different ETags")
+	}
+}
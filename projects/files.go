@@ -0,0 +1,204 @@
+package projects
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+// fileOperationError is returned when file operations can't be applied to the files of a project
+type fileOperationError struct {
+	err error
+}
+
+func (e *fileOperationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fileOperationError) Unwrap() error {
+	return e.err
+}
+
+func (e *fileOperationError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+/*
+checkEntryFile makes sure the entry file of a project is still there after its files change from head to result. A
+project which has already lost its entry file can still be changed.
+*/
+func checkEntryFile(language model.ProjectLanguage, head, result model.Manifest) error {
+	entry := language.EntryFile()
+	if entry == "" {
+		return nil
+	}
+
+	if _, ok := head[entry]; !ok {
+		return nil
+	}
+
+	if _, ok := result[entry]; !ok {
+		return &fileOperationError{fmt.Errorf("%s is the entry file of the project and can't be removed", entry)}
+	}
+
+	return nil
+}
+
+/*
+touchedByOperations returns the head of each path which file operations would remove or replace. When the operations
+can't be applied to the head, every path they name is returned instead, along with the paths within any directory they
+name.
+*/
+func touchedByOperations(head model.Manifest, ops []model.FileOperation) model.Manifest {
+	touched := make(model.Manifest)
+
+	if result, err := model.ApplyFileOperations(model.ProjectFiles(head), ops); err == nil {
+		for p, h := range head {
+			if result[p] != h {
+				touched[p] = h
+			}
+		}
+
+		return touched
+	}
+
+	for _, op := range ops {
+		for _, named := range []string{op.Path, op.From, op.To} {
+			if named == "" {
+				continue
+			}
+
+			for p, h := range head {
+				if p == named || strings.HasPrefix(p, named+"/") {
+					touched[p] = h
+				}
+			}
+		}
+	}
+
+	return touched
+}
+
+// fileOperationsMessage describes a set of file operations when no message is given for the revision they create
+func fileOperationsMessage(ops []model.FileOperation) string {
+	descriptions := make([]string, len(ops))
+	for i, op := range ops {
+		descriptions[i] = op.String()
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+/*
+applyFileOperations deletes and moves files in a project as a new revision, returning the project's files afterwards.
+Only the manifest changes, the content of moved files is left where it is and deleted content is released once no
+revision refers to it. When base is given the operations are rejected with a conflictError unless base is the revision
+at the head of the project.
+*/
+func (r *Repository) applyFileOperations(userId, id string, ops []model.FileOperation, message string, base *int) (
+	model.Revision,
+	model.ProjectFiles,
+	error,
+) {
+	project, err := r.getProjectRecord(userId, id)
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	if err := r.ensureManifest(&project); err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	if message == "" {
+		message = fileOperationsMessage(ops)
+	}
+
+	var touched model.Manifest
+
+	rev, err := r.commit(&project, message, func(head model.Manifest) (model.Manifest, error) {
+		// a stale client is told about the conflict even if its operations no longer apply to the head
+		if base != nil && project.Revision != *base {
+			touched = touchedByOperations(head, ops)
+			return nil, errStaleRevision
+		}
+
+		result, err := model.ApplyFileOperations(model.ProjectFiles(head), ops)
+		if err != nil {
+			return nil, &fileOperationError{err}
+		}
+
+		manifest := model.Manifest(result)
+
+		if err := checkEntryFile(project.Language, head, manifest); err != nil {
+			return nil, err
+		}
+
+		return manifest, nil
+	})
+
+	if err == errStaleRevision {
+		return model.Revision{}, nil, r.newConflictError(&project, *base, touched)
+	}
+
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	files, err := r.readBlobs(rev.Manifest)
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	return rev, files, nil
+}
+
+/*
+ApplyFileOperations deletes, renames and moves files within a project in a single revision. The operations are applied
+in order and none of them are applied if one fails, or if they would remove the project's entry file. The operations
+are only checked against the head of the project when revision is given.
+*/
+func (s *Service) ApplyFileOperations(
+	userId, projectId string,
+	ops []model.FileOperation,
+	message string,
+	revision *int,
+) (model.RevisionView, model.ProjectFiles, error) {
+	rev, files, err := s.repo.applyFileOperations(userId, projectId, ops, message, revision)
+	if err != nil {
+		return model.RevisionView{}, nil, err
+	}
+
+	return rev.View(), files, nil
+}
+
+// DeleteProjectFiles deletes a file or a whole directory from a project
+func (s *Service) DeleteProjectFiles(userId, projectId, path string, revision *int) (
+	model.RevisionView,
+	model.ProjectFiles,
+	error,
+) {
+	return s.ApplyFileOperations(
+		userId,
+		projectId,
+		[]model.FileOperation{{Op: model.FileOpDelete, Path: path}},
+		"",
+		revision,
+	)
+}
+
+// MoveProjectFiles moves or renames a file or directory within a project
+func (s *Service) MoveProjectFiles(userId, projectId, from, to string, revision *int) (
+	model.RevisionView,
+	model.ProjectFiles,
+	error,
+) {
+	return s.ApplyFileOperations(
+		userId,
+		projectId,
+		[]model.FileOperation{{Op: model.FileOpMove, From: from, To: to}},
+		"",
+		revision,
+	)
+}
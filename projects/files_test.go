@@ -0,0 +1,73 @@
+package projects
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestCheckEntryFile(t *testing.T) {
+	head := model.Manifest{
+		"main.go": model.HashContent("package main"),
+		"util.go": model.HashContent("package main // util"),
+	}
+
+	if err := checkEntryFile(model.LanguageGo, head, model.Manifest{"main.go": head["main.go"]}); err != nil {
+		t.Errorf("Expected removing another file to be allowed, got %v", err)
+	}
+
+	err := checkEntryFile(model.LanguageGo, head, model.Manifest{"cmd/main.go": head["main.go"]})
+
+	var opErr *fileOperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Expected a fileOperationError when moving the entry file away, got %v", err)
+	}
+
+	// AssemblyScript projects are compiled from main.ts so main.go is just another file
+	if err := checkEntryFile(model.LanguageAssemblyScript, head, model.Manifest{}); err != nil {
+		t.Errorf("Expected main.go to be removable from an AssemblyScript project, got %v", err)
+	}
+
+	// a project which has already lost its entry file can still be changed
+	if err := checkEntryFile(model.LanguageGo, model.Manifest{"util.go": head["util.go"]}, model.Manifest{}); err != nil {
+		t.Errorf("Expected changes to a project without an entry file to be allowed, got %v", err)
+	}
+}
+
+func TestFileOperationsMessage(t *testing.T) {
+	msg := fileOperationsMessage([]model.FileOperation{
+		{Op: model.FileOpRename, From: "a.go", To: "b.go"},
+		{Op: model.FileOpDelete, Path: "old"},
+	})
+
+	if msg != "Renamed a.go to b.go, Deleted old" {
+		t.Errorf("Unexpected message: %s", msg)
+	}
+}
+
+func TestTouchedByOperations(t *testing.T) {
+	head := model.Manifest{
+		"main.go":      model.HashContent("package main"),
+		"lib/a.go":     model.HashContent("package lib // a"),
+		"lib/b.go":     model.HashContent("package lib // b"),
+		"library.go":   model.HashContent("package main // library"),
+		"untouched.go": model.HashContent("package main // untouched"),
+	}
+
+	touched := touchedByOperations(head, []model.FileOperation{
+		{Op: model.FileOpDelete, Path: "lib"},
+	})
+	if len(touched) != 2 || touched["lib/a.go"] != head["lib/a.go"] || touched["lib/b.go"] != head["lib/b.go"] {
+		t.Errorf("Expected the files within the deleted directory to be touched, got %v", touched)
+	}
+
+	// gone.go was removed at the head so the operations can't be applied, the paths they name are reported instead
+	touched = touchedByOperations(head, []model.FileOperation{
+		{Op: model.FileOpMove, From: "gone.go", To: "main.go"},
+		{Op: model.FileOpDelete, Path: "lib"},
+	})
+	if len(touched) != 3 || touched["main.go"] != head["main.go"] || touched["library.go"] != "" {
+		t.Errorf("Expected the paths named by operations which don't apply to be touched, got %v", touched)
+	}
+}
@@ -0,0 +1,197 @@
+package projects
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"gorm.io/gorm"
+)
+
+// GCReport describes what a garbage collection removed, or would remove during a dry run
+type GCReport struct {
+	DryRun bool `json:"dryRun"`
+	// OrphanedDirs are project directories in storage which don't belong to a project
+	OrphanedDirs []string `json:"orphanedDirs"`
+	// OrphanedFiles is the number of files held in the orphaned directories
+	OrphanedFiles int `json:"orphanedFiles"`
+	// PurgedProjects are the IDs of soft deleted projects removed from the database
+	PurgedProjects []string `json:"purgedProjects"`
+	// ReclaimedBlobs is the number of unreferenced blobs removed
+	ReclaimedBlobs int `json:"reclaimedBlobs"`
+}
+
+/*
+orphanedDirs groups the paths of files in storage into project directories, returning the directories which don't
+belong to one of the live projects along with the number of files in each. live maps each project ID to its owner.
+*/
+func orphanedDirs(paths []string, live map[string]string) map[string]int {
+	orphaned := make(map[string]int)
+
+	for _, p := range paths {
+		parts := strings.SplitN(p, "/", 3)
+
+		// only <userId>/<projectId>/... belongs to a project, anything else such as the blobs and cached builds is
+		// left alone
+		if len(parts) < 3 || parts[0] == blobsDir || parts[0] == buildCacheDir {
+			continue
+		}
+
+		userId, id := parts[0], parts[1]
+		if owner, ok := live[id]; ok && owner == userId {
+			continue
+		}
+
+		orphaned[getProjectDir(userId, id)]++
+	}
+
+	return orphaned
+}
+
+/*
+findOrphanedDirs reconciles the project directories in storage against the projects table. Storage is listed before
+the database is queried, and a project is always created before its files are uploaded, so a project created while
+collecting cannot be mistaken for an orphan.
+*/
+func (r *Repository) findOrphanedDirs() (map[string]int, error) {
+	paths, err := r.storage.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []model.Project
+	if err := r.db.Select("id", "user_id").Find(&projects).Error; err != nil {
+		return nil, err
+	}
+
+	live := make(map[string]string, len(projects))
+	for _, p := range projects {
+		live[p.ID] = p.UserID
+	}
+
+	return orphanedDirs(paths, live), nil
+}
+
+// getDeletedProjectIDs returns the IDs of projects which have been soft deleted
+func (r *Repository) getDeletedProjectIDs() ([]string, error) {
+	var ids []string
+
+	err := r.db.Unscoped().
+		Model(&model.Project{}).
+		Where("deleted_at IS NOT NULL").
+		Pluck("id", &ids).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+/*
+purgeDeletedProjects permanently removes projects which have been soft deleted. The blobs and revisions of a project
+are released when it is deleted so only the rows are left to remove.
+*/
+func (r *Repository) purgeDeletedProjects(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id IN ?", ids).Delete(&model.Asset{}).Error; err != nil {
+			return err
+		}
+
+		if err := deleteJobLogs(tx, ids); err != nil {
+			return err
+		}
+
+		if err := deleteCompileJobs(tx, ids); err != nil {
+			return err
+		}
+
+		return tx.Unscoped().
+			Where("id IN ? AND deleted_at IS NOT NULL", ids).
+			Delete(&model.Project{}).Error
+	})
+}
+
+// countReclaimableBlobs returns the number of blobs which reclaimBlobs would currently delete
+func (r *Repository) countReclaimableBlobs() (int, error) {
+	var count int64
+
+	err := r.db.Model(&model.Blob{}).
+		Where("ref_count <= 0 AND updated_at < ?", time.Now().Add(-blobGracePeriod)).
+		Count(&count).Error
+
+	return int(count), err
+}
+
+/*
+CollectGarbage removes files in storage which don't belong to a project, soft deleted projects and unreferenced blobs.
+When dryRun is true nothing is removed and the report describes what would have been.
+*/
+func (s *Service) CollectGarbage(dryRun bool) (GCReport, error) {
+	report := GCReport{DryRun: dryRun}
+
+	orphaned, err := s.repo.findOrphanedDirs()
+	if err != nil {
+		return report, err
+	}
+
+	for dir, count := range orphaned {
+		report.OrphanedDirs = append(report.OrphanedDirs, dir)
+		report.OrphanedFiles += count
+	}
+	sort.Strings(report.OrphanedDirs)
+
+	report.PurgedProjects, err = s.repo.getDeletedProjectIDs()
+	if err != nil {
+		return report, err
+	}
+
+	if dryRun {
+		report.ReclaimedBlobs, err = s.repo.countReclaimableBlobs()
+		return report, err
+	}
+
+	for _, dir := range report.OrphanedDirs {
+		if err := s.repo.storage.DeleteDir(dir); err != nil {
+			return report, err
+		}
+	}
+
+	// the rows are only purged once their files are gone so a failed run can be picked up again by the next one
+	if err := s.repo.purgeDeletedProjects(report.PurgedProjects); err != nil {
+		return report, err
+	}
+
+	report.ReclaimedBlobs, err = s.repo.reclaimBlobs()
+	return report, err
+}
+
+/*
+StartGC runs a garbage collection every interval in the background
+*/
+func StartGC(interval time.Duration) {
+	s := NewService()
+
+	go func() {
+		for range time.Tick(interval) {
+			report, err := s.CollectGarbage(false)
+			if err != nil {
+				log.Printf("[projects] Error collecting garbage: %v", err)
+				continue
+			}
+
+			log.Printf(
+				"[projects] Collected garbage: %d orphaned directories, %d purged projects, %d reclaimed blobs",
+				len(report.OrphanedDirs),
+				len(report.PurgedProjects),
+				report.ReclaimedBlobs,
+			)
+		}
+	}()
+}
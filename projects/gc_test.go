@@ -0,0 +1,35 @@
+package projects
+
+import "testing"
+
+func TestOrphanedDirs(t *testing.T) {
+	paths := []string{
+		"alice/p1/src/main.go",
+		"alice/p1/build/main.wasm",
+		"alice/p2/src/main.go",
+		"alice/p2/build/main.wasm",
+		"bob/p1/src/main.go",
+		"blobs/ab/abcdef",
+		"builds/0123abcd/main.wasm",
+		"stray.txt",
+	}
+
+	live := map[string]string{"p1": "alice"}
+
+	got := orphanedDirs(paths, live)
+
+	want := map[string]int{
+		"alice/p2": 2,
+		"bob/p1":   1,
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	for dir, count := range want {
+		if got[dir] != count {
+			t.Errorf("Expected %s to have %d orphaned files, got %d", dir, count, got[dir])
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package projects
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/model"
+	"gorm.io/gorm"
+)
+
+const (
+	// jobLogFlushInterval is how often the output of a running job is saved, and how often followers look for more
+	jobLogFlushInterval = 250 * time.Millisecond
+	// jobLogBatch is the most log entries read at once when following a job
+	jobLogBatch = 500
+	// jobLogURLExpiry is how long a signed link to the log of a job can be used to start following it
+	jobLogURLExpiry = 15 * time.Minute
+)
+
+var errInvalidLogSignature = errors.New("invalid or expired link to the job log")
+
+// signJobLog signs a link to the log of a job for a user which can be used until expires
+func signJobLog(userId, jobId string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(env.Get(env.JWT_SECRET)))
+	fmt.Fprintf(mac, "job-log\n%s\n%s\n%d", userId, jobId, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+/*
+jobLogURL returns a link to the log of a job which can be followed without the Authorization header until it expires,
+so that the log can be read with EventSource which can't send headers
+*/
+func jobLogURL(job *model.CompileJob) string {
+	expires := time.Now().Add(jobLogURLExpiry).Unix()
+
+	q := url.Values{}
+	q.Set("user", job.UserID)
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", signJobLog(job.UserID, job.ID, expires))
+
+	return fmt.Sprintf("%s/log?%s", jobURL(job.ProjectID, job.ID), q.Encode())
+}
+
+// verifyJobLogURL checks the query of a link made by jobLogURL, returning the user it was made for
+func verifyJobLogURL(jobId string, query url.Values) (string, error) {
+	userId := query.Get("user")
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || userId == "" {
+		return "", errInvalidLogSignature
+	}
+
+	if !hmac.Equal([]byte(signJobLog(userId, jobId, expires)), []byte(query.Get("signature"))) {
+		return "", errInvalidLogSignature
+	}
+
+	if time.Now().Unix() > expires {
+		return "", errInvalidLogSignature
+	}
+
+	return userId, nil
+}
+
+// lastJobLogSeq returns the number of the last entry logged by a job, 0 if it hasn't logged anything
+func (r *Repository) lastJobLogSeq(jobId string) (int, error) {
+	var seq int
+
+	err := r.db.Model(&model.CompileJobLog{}).
+		Select("COALESCE(MAX(seq), 0)").
+		Where("job_id = ?", jobId).
+		Scan(&seq).Error
+
+	return seq, err
+}
+
+func (r *Repository) saveJobLogs(tx *gorm.DB, logs []model.CompileJobLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	return tx.Create(&logs).Error
+}
+
+// getJobLogs returns the entries logged by a job after the entry numbered after, oldest first
+func (r *Repository) getJobLogs(jobId string, after int) ([]model.CompileJobLog, error) {
+	var logs []model.CompileJobLog
+
+	err := r.db.Where("job_id = ? AND seq > ?", jobId, after).Order("seq").Limit(jobLogBatch).Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// deleteJobLogs removes the logs of the jobs of projects which have been purged
+func deleteJobLogs(tx *gorm.DB, projectIds []string) error {
+	jobs := tx.Model(&model.CompileJob{}).Select("id").Where("project_id IN ?", projectIds)
+
+	return tx.Where("job_id IN (?)", jobs).Delete(&model.CompileJobLog{}).Error
+}
+
+/*
+jobLogger records the log of a running job. Entries are saved in batches every jobLogFlushInterval rather than one at a
+time, and whatever is left when the job finishes is saved along with its result.
+*/
+type jobLogger struct {
+	repo    *Repository
+	jobId   string
+	mu      sync.Mutex
+	seq     int
+	pending []model.CompileJobLog
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newJobLogger starts logging for a job, carrying on from anything logged by an earlier attempt to run it
+func newJobLogger(repo *Repository, jobId string) *jobLogger {
+	seq, err := repo.lastJobLogSeq(jobId)
+	if err != nil {
+		log.Printf("[projects] Error reading the log of compile job %s: %v", jobId, err)
+	}
+
+	l := &jobLogger{
+		repo:    repo,
+		jobId:   jobId,
+		seq:     seq,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go l.run()
+	return l
+}
+
+func (l *jobLogger) log(entry model.CompileJobLog) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	entry.JobID = l.jobId
+	entry.Seq = l.seq
+	entry.CreatedAt = time.Now()
+
+	l.pending = append(l.pending, entry)
+}
+
+// output logs a line written by a compiler
+func (l *jobLogger) output(stream, line string) {
+	l.log(model.CompileJobLog{
+		Event:  model.JobLogOutput,
+		Stream: stream,
+		Text:   line,
+	})
+}
+
+// take removes the entries waiting to be saved
+func (l *jobLogger) take() []model.CompileJobLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pending := l.pending
+	l.pending = nil
+
+	return pending
+}
+
+func (l *jobLogger) run() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(jobLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.repo.saveJobLogs(l.repo.db, l.take()); err != nil {
+			log.Printf("[projects] Error saving the log of compile job %s: %v", l.jobId, err)
+		}
+	}
+}
+
+// close stops saving entries in the background, any logged afterwards are left for take
+func (l *jobLogger) close() {
+	close(l.stop)
+	<-l.stopped
+}
+
+/*
+FollowCompileJobLog passes each entry in the log of a compile job, after the entry numbered after, to send as they are
+logged. It returns once the job has finished and its whole log has been sent, ctx is done or maxJobWait has passed,
+reporting whether the job finished.
+*/
+func (s *Service) FollowCompileJobLog(
+	ctx context.Context,
+	userId, projectId, jobId string,
+	after int,
+	send func(model.CompileJobLogView) error,
+) (finished bool, err error) {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxJobWait)
+	defer cancel()
+
+	ticker := time.NewTicker(jobLogFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		// the job is read before its log, since the rest of the log is saved along with the result of the job, a job
+		// which has finished has nothing left to log
+		job, err := s.repo.getCompileJob(projectId, jobId)
+		if err != nil {
+			return false, err
+		}
+
+		logs, err := s.repo.getJobLogs(jobId, after)
+		if err != nil {
+			return false, err
+		}
+
+		for i := range logs {
+			if err := send(logs[i].View()); err != nil {
+				return false, err
+			}
+			after = logs[i].Seq
+		}
+
+		if job.Status.Finished() && len(logs) < jobLogBatch {
+			return true, nil
+		}
+
+		if len(logs) == jobLogBatch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+}
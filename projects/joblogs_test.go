@@ -0,0 +1,43 @@
+package projects
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestJobLogURL(t *testing.T) {
+	job := &model.CompileJob{ID: "job", ProjectID: "project", UserID: "user"}
+
+	u, err := url.Parse(jobLogURL(job))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userId, err := verifyJobLogURL("job", u.Query()); err != nil || userId != "user" {
+		t.Errorf("Expected the link to be valid for the job's user, got %q, %v", userId, err)
+	}
+
+	if _, err := verifyJobLogURL("other", u.Query()); err != errInvalidLogSignature {
+		t.Errorf("Expected the link to be rejected for another job, got %v", err)
+	}
+
+	forged := u.Query()
+	forged.Set("user", "someone-else")
+	if _, err := verifyJobLogURL("job", forged); err != errInvalidLogSignature {
+		t.Errorf("Expected the link to be rejected for another user, got %v", err)
+	}
+
+	expires := time.Now().Add(-time.Minute).Unix()
+	expired := url.Values{
+		"user":      {"user"},
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {signJobLog("user", "job", expires)},
+	}
+	if _, err := verifyJobLogURL("job", expired); err != errInvalidLogSignature {
+		t.Errorf("Expected an expired link to be rejected, got %v", err)
+	}
+}
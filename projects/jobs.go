@@ -0,0 +1,646 @@
+package projects
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/storage"
+	"github.com/sammyhass/web-ide/server/wasm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// jobPollInterval is how often idle workers look for jobs queued by other instances
+	jobPollInterval = 2 * time.Second
+	// abandonedJobAfter is how long a running job can go without a heartbeat before it is assumed its worker has gone and
+	// it is run again
+	abandonedJobAfter = 15 * time.Minute
+	// jobHeartbeatInterval is how often a worker reports that the job it is running is still running
+	jobHeartbeatInterval = time.Minute
+	// maxJobWait is the longest a request asking to wait for a job is held open
+	maxJobWait = 2 * time.Minute
+	// jobHistory is the number of recent jobs listed for a project
+	jobHistory = 20
+)
+
+var errJobNotFound = errors.New("compile job not found")
+
+// errJobReclaimed is returned when a job has been claimed again by another worker since it was claimed by this one
+var errJobReclaimed = errors.New("compile job has been claimed by another worker")
+
+// errStaleBuild is returned when a build would overwrite the artifacts of a build of a later revision
+var errStaleBuild = errors.New("a later revision of the project has already been built")
+
+// toolchainError is returned when a project can't be compiled because the toolchain for its language isn't installed
+type toolchainError struct {
+	err error
+}
+
+func (e *toolchainError) Error() string {
+	return e.err.Error()
+}
+
+func (e *toolchainError) Unwrap() error {
+	return e.err
+}
+
+func (e *toolchainError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// jobQueued wakes an idle worker when a job is queued by this instance
+var jobQueued = make(chan struct{}, 1)
+
+// localWorkers is the number of compile workers running on this instance
+var localWorkers int
+
+// jobURL returns the link to a compile job served through the API
+func jobURL(projectId, jobId string) string {
+	return fmt.Sprintf("%s/projects/%s/jobs/%s", storage.PublicURL(), projectId, jobId)
+}
+
+func notifyJobQueued() {
+	select {
+	case jobQueued <- struct{}{}:
+	default:
+	}
+}
+
+/*
+enqueueCompileJob queues a build of a project. A job which is still queued will build the latest files of the project
+when it starts, so it is returned instead of queueing another.
+*/
+func (r *Repository) enqueueCompileJob(userId, projectId string) (model.CompileJob, error) {
+	var job model.CompileJob
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// the project row is locked so that concurrent requests can't both queue a job
+		var project model.Project
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", projectId).
+			First(&project).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("project_id = ? AND status = ?", projectId, model.JobQueued).First(&job).Error
+		if err == nil {
+			return nil
+		}
+
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		job = model.NewCompileJob(userId, projectId)
+		return tx.Create(&job).Error
+	})
+
+	return job, err
+}
+
+func (r *Repository) getCompileJob(projectId, jobId string) (model.CompileJob, error) {
+	var job model.CompileJob
+
+	err := r.db.Where("id = ? AND project_id = ?", jobId, projectId).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.CompileJob{}, errJobNotFound
+	}
+
+	if err != nil {
+		return model.CompileJob{}, err
+	}
+
+	return job, nil
+}
+
+func (r *Repository) getCompileJobs(projectId string) ([]model.CompileJob, error) {
+	var jobs []model.CompileJob
+
+	err := r.db.Where("project_id = ?", projectId).Order("created_at DESC").Limit(jobHistory).Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// getQueuePosition returns the number of jobs which were queued before a job and haven't started yet
+func (r *Repository) getQueuePosition(job *model.CompileJob) (int, error) {
+	var count int64
+
+	err := r.db.Model(&model.CompileJob{}).
+		Where("status = ? AND created_at < ?", model.JobQueued, job.CreatedAt).
+		Count(&count).Error
+
+	return int(count), err
+}
+
+/*
+claimCompileJob marks a queued job as running and returns it, ok is false when there is nothing to run. The oldest job
+of the users with the fewest jobs running is claimed first so that one user can't fill every worker. Jobs are claimed
+with SKIP LOCKED so that workers on several instances never run the same job, jobs of projects which already have a
+job running are left queued until it finishes, and jobs whose worker hasn't sent a heartbeat for abandonedJobAfter are
+claimed again.
+*/
+func (r *Repository) claimCompileJob() (job model.CompileJob, ok bool, err error) {
+	abandoned := time.Now().Add(-abandonedJobAfter)
+
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where(tx.Where("status = ?", model.JobQueued).
+				Or("status = ? AND COALESCE(heartbeat_at, started_at) < ?", model.JobRunning, abandoned)).
+			Where("NOT EXISTS (?)", runningJobs(tx, "compile_jobs.project_id", "compile_jobs.id", abandoned).Select("1")).
+			Order(fmt.Sprintf(
+				"(SELECT COUNT(*) FROM compile_jobs AS running "+
+					"WHERE running.user_id = compile_jobs.user_id AND running.status = '%s'), created_at",
+				model.JobRunning,
+			)).
+			First(&job).Error
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// another worker may have claimed a job of the same project since the jobs were read, the project row is
+		// locked so that only one of them sees no job running
+		var project model.Project
+		err = tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", job.ProjectID).
+			Find(&project).Error
+		if err != nil {
+			return err
+		}
+
+		var running int64
+		if err := runningJobs(tx, "?", "?", abandoned, job.ProjectID, job.ID).Count(&running).Error; err != nil {
+			return err
+		}
+
+		if running > 0 {
+			return nil
+		}
+
+		now := time.Now()
+		job.Status = model.JobRunning
+		job.StartedAt = sql.NullTime{Time: now, Valid: true}
+		job.HeartbeatAt = sql.NullTime{Time: now, Valid: true}
+		job.Attempts++
+		ok = true
+
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"started_at":   job.StartedAt,
+			"heartbeat_at": job.HeartbeatAt,
+			"attempts":     job.Attempts,
+		}).Error
+	})
+
+	return job, ok, err
+}
+
+/*
+runningJobs selects the jobs of a project which are running and haven't been abandoned, other than the given job. The
+project and job are given as SQL expressions with vars holding their values.
+*/
+func runningJobs(tx *gorm.DB, project, job string, abandoned time.Time, vars ...interface{}) *gorm.DB {
+	where := fmt.Sprintf(
+		"running.project_id = %s AND running.id <> %s AND running.status = ? "+
+			"AND COALESCE(running.heartbeat_at, running.started_at) >= ?",
+		project, job,
+	)
+
+	return tx.Session(&gorm.Session{NewDB: true}).
+		Table("compile_jobs AS running").
+		Where(where, append(vars, model.JobRunning, abandoned)...)
+}
+
+/*
+heartbeatCompileJob records that a job is still running, returning errJobReclaimed if another worker has claimed the job
+since this attempt was claimed
+*/
+func (r *Repository) heartbeatCompileJob(job *model.CompileJob) error {
+	res := r.db.Model(&model.CompileJob{}).
+		Where("id = ? AND attempts = ? AND status = ?", job.ID, job.Attempts, model.JobRunning).
+		Update("heartbeat_at", time.Now())
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return errJobReclaimed
+	}
+
+	return nil
+}
+
+/*
+finishCompileJob records the outcome of a job, saving the rest of its log along with it so that anyone following the
+log sees the job finish once the whole log has been saved
+*/
+func (r *Repository) finishCompileJob(job *model.CompileJob, logs *jobLogger) error {
+	job.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	logs.close()
+	logs.log(model.CompileJobLog{
+		Event:      model.JobLogFinish,
+		Text:       string(job.Status),
+		DurationMs: job.FinishedAt.Time.Sub(job.StartedAt.Time).Milliseconds(),
+	})
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := r.updateFinishedJob(tx, job); err != nil {
+			return err
+		}
+
+		return r.saveJobLogs(tx, logs.take())
+	})
+}
+
+// updateFinishedJob records the outcome of a job, returning errJobReclaimed if the job has since been claimed again
+func (r *Repository) updateFinishedJob(tx *gorm.DB, job *model.CompileJob) error {
+	res := tx.Model(job).Where("attempts = ?", job.Attempts).Updates(map[string]interface{}{
+		"status":      job.Status,
+		"revision":    job.Revision,
+		"error":       job.Error,
+		"artifacts":   job.Artifacts,
+		"diagnostics": job.Diagnostics,
+		"cache_hit":   job.CacheHit,
+		"toolchain":   job.Toolchain,
+		"finished_at": job.FinishedAt,
+
+		"compiler_queue_depth": job.CompilerQueueDepth,
+		"compiler_wait_ms":     job.CompilerWaitMs,
+	})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return errJobReclaimed
+	}
+
+	return nil
+}
+
+/*
+reserveBuild records that the artifacts of a project are about to be replaced by a build of revision, returning
+errStaleBuild when a later revision has already been built so that an older build never overwrites a newer one
+*/
+func (r *Repository) reserveBuild(projectId string, revision int) error {
+	res := r.db.Model(&model.Project{}).
+		Where("id = ? AND build_revision <= ?", projectId, revision).
+		Update("build_revision", revision)
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return errStaleBuild
+	}
+
+	return nil
+}
+
+// deleteCompileJobs removes the jobs of projects which have been purged
+func deleteCompileJobs(tx *gorm.DB, projectIds []string) error {
+	return tx.Where("project_id IN ?", projectIds).Delete(&model.CompileJob{}).Error
+}
+
+/*
+buildProject compiles the latest files of a project and uploads the artifacts, recording the revision which was built
+and the artifacts written on the job. Each line written by the compilers is passed to output. Builds are looked up in
+the build cache first, and a build which isn't cached is added to it once it has been compiled.
+*/
+func (s *Service) buildProject(ctx context.Context, job *model.CompileJob, output wasm.OutputFunc) error {
+	proj, err := s.repo.getProjectByID(job.UserID, job.ProjectID)
+	if err != nil {
+		return err
+	}
+	job.Revision = proj.Revision
+
+	var fname string
+	switch proj.Language {
+	case model.LanguageAssemblyScript.String():
+		fname = model.LanguageAssemblyScript.EntryFile()
+	case model.LanguageGo.String():
+		fname = model.LanguageGo.EntryFile()
+	default:
+		return errors.New("unsupported language")
+	}
+
+	if _, err := model.GetFileContent(proj.Files, fname); err != nil {
+		job.Diagnostics = model.Diagnostics{{
+			File:     fname,
+			Severity: model.SeverityError,
+			Message:  err.Error(),
+		}}
+		return err
+	}
+
+	language := model.GetProjectLanguage(proj.Language)
+
+	version, err := s.pinCompilerVersion(job.ProjectID, language, proj.CompilerVersion)
+	if err != nil {
+		return err
+	}
+
+	files := model.FileViewsToProjectFiles(proj.Files)
+	opts := wasm.CompileOpts{
+		GenWat:   true,
+		User:     job.UserID,
+		Output:   output,
+		Settings: proj.BuildSettings,
+		Version:  version,
+	}
+
+	key := s.buildCacheKey(language, files, opts)
+	if key != "" {
+		hit, err := s.useCachedBuild(job, key)
+		if hit {
+			return err
+		}
+
+		if err != nil {
+			log.Printf("[projects] Error using cached build %s, compiling instead: %v", key, err)
+		}
+	}
+
+	res, err := wasm.Compile(ctx, language, files, opts)
+
+	job.CompilerQueueDepth = res.Queue.Depth
+	job.CompilerWaitMs = res.Queue.Wait.Milliseconds()
+	job.Diagnostics = res.Diagnostics
+	job.Toolchain = res.Toolchain
+
+	var compileErr *wasm.CompileError
+	var limitErr *wasm.LimitError
+	var settingsErr *wasm.SettingsError
+	var unavailableErr *wasm.UnavailableError
+	switch {
+	case errors.As(err, &compileErr):
+		job.Diagnostics = compileErr.Diagnostics
+	case errors.As(err, &limitErr):
+		job.Diagnostics = model.Diagnostics{{
+			Severity: model.SeverityError,
+			Message:  limitErr.Error(),
+			Code:     "limit",
+		}}
+	case errors.As(err, &settingsErr):
+		job.Diagnostics = model.Diagnostics{{
+			Severity: model.SeverityError,
+			Message:  settingsErr.Error(),
+			Code:     "settings",
+		}}
+	case errors.As(err, &unavailableErr):
+		job.Diagnostics = model.Diagnostics{{
+			Severity: model.SeverityError,
+			Message:  unavailableErr.Error(),
+			Code:     "toolchain",
+		}}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.reserveBuild(job.ProjectID, job.Revision); err != nil {
+		return err
+	}
+
+	artifacts, size, err := s.storeBuild(job, key, res)
+	if err != nil {
+		return err
+	}
+	job.Artifacts = artifacts
+
+	return s.repo.setBuildSize(job.ProjectID, size.Size, size.StoredSize)
+}
+
+/*
+runCompileJob builds the project of a claimed job and records whether the build succeeded, logging the output of the
+compilers as it is written. A heartbeat is sent while the job runs so that it isn't claimed again, and the build is
+stopped if it is claimed again anyway.
+*/
+func (s *Service) runCompileJob(job *model.CompileJob) {
+	job.Status = model.JobSucceeded
+	job.Error = ""
+	job.Diagnostics = nil
+	job.CacheHit = false
+	job.Toolchain = ""
+
+	logs := newJobLogger(s.repo, job.ID)
+	logs.log(model.CompileJobLog{
+		Event:      model.JobLogStart,
+		DurationMs: job.StartedAt.Time.Sub(job.CreatedAt).Milliseconds(),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.heartbeat(ctx, cancel, job)
+
+	if err := s.buildProject(ctx, job, logs.output); err != nil {
+		job.Status = model.JobFailed
+		job.Error = err.Error()
+		job.Artifacts = nil
+	}
+
+	if err := s.repo.finishCompileJob(job, logs); err != nil {
+		log.Printf("[projects] Error recording the result of compile job %s: %v", job.ID, err)
+	}
+}
+
+// heartbeat reports that a job is still running until ctx is done, calling cancel if the job is claimed again
+func (s *Service) heartbeat(ctx context.Context, cancel context.CancelFunc, job *model.CompileJob) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.repo.heartbeatCompileJob(job)
+		if errors.Is(err, errJobReclaimed) {
+			log.Printf("[projects] Compile job %s was claimed by another worker, stopping", job.ID)
+			cancel()
+			return
+		}
+
+		if err != nil {
+			log.Printf("[projects] Error sending a heartbeat for compile job %s: %v", job.ID, err)
+		}
+	}
+}
+
+/*
+jobView describes a job with links to its artifacts, which are presigned when presign is true, along with its position
+in the queue if it hasn't started
+*/
+func (s *Service) jobView(job *model.CompileJob, presign bool) (model.CompileJobView, error) {
+	view := job.View(func(name string) string {
+		if !presign {
+			return artifactURL(job.ProjectID, name)
+		}
+
+		url, err := s.repo.genBuildPresignedURL(job.UserID, job.ProjectID, name)
+		if err != nil {
+			log.Printf("[projects] Error presigning %s for compile job %s: %v", name, job.ID, err)
+		}
+
+		return url
+	})
+	view.LogURL = jobLogURL(job)
+
+	if job.Status != model.JobQueued {
+		return view, nil
+	}
+
+	var err error
+	view.QueuePosition, err = s.repo.getQueuePosition(job)
+
+	return view, err
+}
+
+/*
+CompileProject queues a build of one of a user's projects, returning the job which will build it. The job runs in the
+background on one of the compile workers. When this instance runs workers, projects whose language it can't compile
+aren't queued, otherwise the workers are on other instances whose toolchains can't be checked.
+*/
+func (s *Service) CompileProject(userId, projectId string) (model.CompileJobView, error) {
+	proj, err := s.repo.getProjectRecord(userId, projectId)
+	if err != nil {
+		return model.CompileJobView{}, err
+	}
+
+	if localWorkers > 0 {
+		if err := wasm.CheckToolchain(proj.Language, proj.CompilerVersion); err != nil {
+			return model.CompileJobView{}, &toolchainError{err}
+		}
+	}
+
+	job, err := s.repo.enqueueCompileJob(userId, projectId)
+	if err != nil {
+		return model.CompileJobView{}, err
+	}
+
+	notifyJobQueued()
+	return s.jobView(&job, false)
+}
+
+// GetCompileJob describes a compile job of one of a user's projects
+func (s *Service) GetCompileJob(userId, projectId, jobId string, presign bool) (model.CompileJobView, error) {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return model.CompileJobView{}, err
+	}
+
+	job, err := s.repo.getCompileJob(projectId, jobId)
+	if err != nil {
+		return model.CompileJobView{}, err
+	}
+
+	return s.jobView(&job, presign)
+}
+
+// GetCompileJobs lists the most recent compile jobs of one of a user's projects, newest first
+func (s *Service) GetCompileJobs(userId, projectId string) ([]model.CompileJobView, error) {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return nil, err
+	}
+
+	jobs, err := s.repo.getCompileJobs(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]model.CompileJobView, len(jobs))
+	for i := range jobs {
+		if views[i], err = s.jobView(&jobs[i], false); err != nil {
+			return nil, err
+		}
+	}
+
+	return views, nil
+}
+
+/*
+WaitForCompileJob waits for a compile job to finish, returning the job as it is when it finishes, ctx is done or
+maxJobWait has passed
+*/
+func (s *Service) WaitForCompileJob(
+	ctx context.Context,
+	userId, projectId, jobId string,
+	presign bool,
+) (model.CompileJobView, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxJobWait)
+	defer cancel()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		job, err := s.GetCompileJob(userId, projectId, jobId, presign)
+		if err != nil || job.Status.Finished() {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// compileWorker runs queued jobs one at a time until there are none left, then waits for more to be queued
+func (s *Service) compileWorker() {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, ok, err := s.repo.claimCompileJob()
+		if err != nil {
+			log.Printf("[projects] Error claiming a compile job: %v", err)
+		}
+
+		if ok {
+			s.runCompileJob(&job)
+			continue
+		}
+
+		select {
+		case <-jobQueued:
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+StartCompileWorkers runs workers in the background which build the projects of queued compile jobs
+*/
+func StartCompileWorkers(workers int) {
+	s := NewService()
+	localWorkers = workers
+
+	for i := 0; i < workers; i++ {
+		go s.compileWorker()
+	}
+}
@@ -0,0 +1,397 @@
+package projects
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/model"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMaxFileSize = 1 << 20
+	defaultMaxFiles    = 200
+	defaultMaxProjects = 50
+	defaultMaxStorage  = 100 << 20
+)
+
+/*
+Quota limits how much a single user can store, a limit of 0 means there is no limit
+*/
+type Quota struct {
+	MaxFileSize int64 `json:"max_file_size"` // MaxFileSize is the largest source file allowed in bytes
+	MaxFiles    int   `json:"max_files"`     // MaxFiles is the most source files allowed in one project
+	MaxProjects int   `json:"max_projects"`
+	MaxStorage  int64 `json:"max_storage"` // MaxStorage is the most bytes a user can store across all of their projects
+}
+
+// quotaFromEnv reads the quota from the environment, falling back to the defaults for any limit which isn't set
+func quotaFromEnv() Quota {
+	return Quota{
+		MaxFileSize: envInt(env.OPT_QUOTA_MAX_FILE_SIZE, defaultMaxFileSize),
+		MaxFiles:    int(envInt(env.OPT_QUOTA_MAX_FILES, defaultMaxFiles)),
+		MaxProjects: int(envInt(env.OPT_QUOTA_MAX_PROJECTS, defaultMaxProjects)),
+		MaxStorage:  envInt(env.OPT_QUOTA_MAX_STORAGE, defaultMaxStorage),
+	}
+}
+
+func envInt(key env.EnvKey, fallback int64) int64 {
+	v := env.Get(key)
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		log.Fatalf("[projects] %s must be a positive number of bytes or items, got %s", key, v)
+	}
+
+	return n
+}
+
+/*
+Usage is how much a user is currently storing. StorageBytes counts the content of the files at the head of each of the
+user's projects along with their assets and builds, content shared between projects is counted once for each project.
+StoredBytes is how much of the storage that content takes up after compression.
+*/
+type Usage struct {
+	Projects     int   `json:"projects"`
+	Files        int   `json:"files"`
+	StorageBytes int64 `json:"storage_bytes"`
+	StoredBytes  int64 `json:"stored_bytes"`
+	Quota        Quota `json:"quota"`
+}
+
+// sizes holds the totals selected when summing the size and stored size of rows
+type sizes struct {
+	Size       int64
+	StoredSize int64
+}
+
+// quotaError is returned when a change would take a user over their quota
+type quotaError struct {
+	msg    string
+	status int
+}
+
+func (e *quotaError) Error() string {
+	return e.msg
+}
+
+func (e *quotaError) StatusCode() int {
+	return e.status
+}
+
+func newQuotaError(format string, args ...interface{}) error {
+	return &quotaError{msg: fmt.Sprintf(format, args...), status: http.StatusForbidden}
+}
+
+// allowStorage makes sure size more bytes can be stored on top of the used bytes
+func (q Quota) allowStorage(used, size int64) error {
+	if q.MaxStorage == 0 || size <= 0 || used+size <= q.MaxStorage {
+		return nil
+	}
+
+	return newQuotaError(
+		"storage limit of %d bytes reached, %d bytes are in use and %d more were requested",
+		q.MaxStorage,
+		used,
+		size,
+	)
+}
+
+// sumSizes selects the total size and stored size of the rows of a table, rows stored before files were compressed
+// have no stored size and count their full size
+func sumSizes(table string) string {
+	return fmt.Sprintf(
+		"COALESCE(SUM(%[1]s.size), 0) AS size, "+
+			"COALESCE(SUM(COALESCE(NULLIF(%[1]s.stored_size, 0), %[1]s.size)), 0) AS stored_size",
+		table,
+	)
+}
+
+/*
+headSizes totals the content referenced by each manifest, content used by more than one file of a manifest is counted
+once for that manifest
+*/
+func headSizes(tx *gorm.DB, manifests ...model.Manifest) (sizes, error) {
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, m := range manifests {
+		for _, h := range m.Hashes() {
+			if !seen[h] {
+				seen[h] = true
+				hashes = append(hashes, h)
+			}
+		}
+	}
+
+	if len(hashes) == 0 {
+		return sizes{}, nil
+	}
+
+	var blobs []model.Blob
+	if err := tx.Select("hash", "size", "stored_size").Where("hash IN ?", hashes).Find(&blobs).Error; err != nil {
+		return sizes{}, err
+	}
+
+	byHash := make(map[string]model.Blob, len(blobs))
+	for _, b := range blobs {
+		byHash[b.Hash] = b
+	}
+
+	var total sizes
+	for _, m := range manifests {
+		for _, h := range m.Hashes() {
+			b := byHash[h]
+			total.Size += b.Size
+
+			// blobs stored before files were compressed have no stored size and count their full size
+			if b.StoredSize > 0 {
+				total.StoredSize += b.StoredSize
+			} else {
+				total.StoredSize += b.Size
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// getUsage totals the projects, files and bytes stored by a user
+func (r *Repository) getUsage(userId string) (Usage, error) {
+	return usageOf(r.db, userId)
+}
+
+// usageOf totals the projects, files and bytes stored by a user as seen by tx
+func usageOf(tx *gorm.DB, userId string) (Usage, error) {
+	var usage Usage
+
+	var manifests []model.Manifest
+	if err := tx.Model(&model.Project{}).Where("user_id = ?", userId).Pluck("manifest", &manifests).Error; err != nil {
+		return Usage{}, err
+	}
+
+	usage.Projects = len(manifests)
+	for _, m := range manifests {
+		usage.Files += len(m)
+	}
+
+	fileBytes, err := headSizes(tx, manifests...)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	var assetBytes, buildBytes sizes
+
+	err = tx.Model(&model.Asset{}).
+		Joins("JOIN projects ON projects.id = assets.project_id").
+		Where("projects.user_id = ? AND projects.deleted_at IS NULL", userId).
+		Select(sumSizes("assets")).
+		Scan(&assetBytes).Error
+	if err != nil {
+		return Usage{}, err
+	}
+
+	err = tx.Model(&model.Project{}).
+		Where("user_id = ?", userId).
+		Select("COALESCE(SUM(build_size), 0) AS size, " +
+			"COALESCE(SUM(COALESCE(NULLIF(build_stored_size, 0), build_size)), 0) AS stored_size").
+		Scan(&buildBytes).Error
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage.StorageBytes = fileBytes.Size + assetBytes.Size + buildBytes.Size
+	usage.StoredBytes = fileBytes.StoredSize + assetBytes.StoredSize + buildBytes.StoredSize
+	return usage, nil
+}
+
+/*
+checkStorageWithin makes sure a user can store another size bytes from within a transaction. The user's usage stays
+locked until the transaction ends, so changes made at the same time are checked one after another rather than each
+against the usage from before the other.
+*/
+func checkStorageWithin(tx *gorm.DB, quota Quota, userId string, size int64) error {
+	if quota.MaxStorage == 0 || size <= 0 {
+		return nil
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "usage:"+userId).Error; err != nil {
+		return err
+	}
+
+	usage, err := usageOf(tx, userId)
+	if err != nil {
+		return err
+	}
+
+	return quota.allowStorage(usage.StorageBytes, size)
+}
+
+/*
+checkProjectsWithin makes sure a user can create another project from within the transaction which creates it. The
+user's usage stays locked until the transaction ends, so projects created at the same time can't each see room for one
+more.
+*/
+func checkProjectsWithin(tx *gorm.DB, quota Quota, userId string) error {
+	if quota.MaxProjects == 0 {
+		return nil
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "usage:"+userId).Error; err != nil {
+		return err
+	}
+
+	var projects int64
+	if err := tx.Model(&model.Project{}).Where("user_id = ?", userId).Count(&projects).Error; err != nil {
+		return err
+	}
+
+	if projects >= int64(quota.MaxProjects) {
+		return newQuotaError("project limit of %d reached", quota.MaxProjects)
+	}
+
+	return nil
+}
+
+/*
+checkManifestQuota makes sure the head of a project can move to manifest without going over the limits on the number of
+files in a project and the total storage of its owner, it must be called within the transaction which moves the head
+*/
+func checkManifestQuota(tx *gorm.DB, quota Quota, project *model.Project, manifest model.Manifest) error {
+	if quota.MaxFiles > 0 && len(manifest) > quota.MaxFiles && len(manifest) > len(project.Manifest) {
+		return newQuotaError("projects can have at most %d files", quota.MaxFiles)
+	}
+
+	if quota.MaxStorage == 0 {
+		return nil
+	}
+
+	before, err := headSizes(tx, project.Manifest)
+	if err != nil {
+		return err
+	}
+
+	after, err := headSizes(tx, manifest)
+	if err != nil {
+		return err
+	}
+
+	return checkStorageWithin(tx, quota, project.UserID, after.Size-before.Size)
+}
+
+/*
+getProjectSize returns the number of bytes a copy of a project would add to its owner's usage, the content of the
+project's files along with its assets
+*/
+func (r *Repository) getProjectSize(project *model.Project) (int64, error) {
+	if err := r.ensureManifest(project); err != nil {
+		return 0, err
+	}
+
+	files, err := headSizes(r.db, project.Manifest)
+	if err != nil {
+		return 0, err
+	}
+
+	var assetBytes int64
+	err = r.db.Model(&model.Asset{}).
+		Where("project_id = ?", project.ID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&assetBytes).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return files.Size + assetBytes, nil
+}
+
+// setBuildSize records the size of the latest build of a project
+func (r *Repository) setBuildSize(projectId string, size, storedSize int64) error {
+	return r.db.Model(&model.Project{}).Where("id = ?", projectId).Updates(map[string]interface{}{
+		"build_size":        size,
+		"build_stored_size": storedSize,
+	}).Error
+}
+
+// GetUsage returns how much a user is currently storing along with their quota
+func (s *Service) GetUsage(userId string) (Usage, error) {
+	usage, err := s.repo.getUsage(userId)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage.Quota = s.quota
+	return usage, nil
+}
+
+// checkStorageQuota makes sure a user can store another size bytes
+func (s *Service) checkStorageQuota(userId string, size int64) error {
+	if s.quota.MaxStorage == 0 {
+		return nil
+	}
+
+	usage, err := s.repo.getUsage(userId)
+	if err != nil {
+		return err
+	}
+
+	return s.quota.allowStorage(usage.StorageBytes, size)
+}
+
+/*
+checkFilesQuota makes sure files can be saved to a project without going over the limits on the size of each file, the
+number of files in the project and the total storage of its owner. The project's manifest must already have been
+ensured. The limits are checked again when the files are committed, this check turns away saves which are over them
+before any content is uploaded.
+*/
+func (s *Service) checkFilesQuota(userId string, project *model.Project, files model.ProjectFiles) error {
+	var size int64
+	added := 0
+	replaced := make(model.Manifest)
+
+	for p, content := range files {
+		if s.quota.MaxFileSize > 0 && int64(len(content)) > s.quota.MaxFileSize {
+			return &quotaError{
+				msg:    fmt.Sprintf("%s is larger than the file size limit of %d bytes", p, s.quota.MaxFileSize),
+				status: http.StatusRequestEntityTooLarge,
+			}
+		}
+
+		h, ok := project.Manifest[p]
+		if !ok {
+			added++
+		}
+
+		// files sent back unchanged don't add anything
+		if h != model.HashContent(content) {
+			size += int64(len(content))
+			if ok {
+				replaced[p] = h
+			}
+		}
+	}
+
+	if s.quota.MaxFiles > 0 && len(project.Manifest)+added > s.quota.MaxFiles {
+		return newQuotaError("projects can have at most %d files", s.quota.MaxFiles)
+	}
+
+	if s.quota.MaxStorage == 0 {
+		return nil
+	}
+
+	// the content being replaced stops counting once the save is committed
+	if len(replaced) > 0 {
+		old, err := headSizes(s.repo.db, replaced)
+		if err != nil {
+			return err
+		}
+		size -= old.Size
+	}
+
+	return s.checkStorageQuota(userId, size)
+}
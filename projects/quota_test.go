@@ -0,0 +1,63 @@
+package projects
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestCheckFilesQuota(t *testing.T) {
+	s := &Service{quota: Quota{MaxFileSize: 16, MaxFiles: 2}}
+
+	project := &model.Project{
+		Manifest: model.Manifest{"main.go": model.HashContent("package main")},
+	}
+
+	if err := s.checkFilesQuota("user", project, model.ProjectFiles{
+		"main.go": "package main",
+		"lib.go":  "package lib",
+	}); err != nil {
+		t.Errorf("Expected files within the quota to be allowed, got %v", err)
+	}
+
+	var qe *quotaError
+
+	err := s.checkFilesQuota("user", project, model.ProjectFiles{
+		"big.go": strings.Repeat("a", 17),
+	})
+	if !errors.As(err, &qe) || qe.StatusCode() != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected a file over the size limit to be rejected, got %v", err)
+	}
+
+	err = s.checkFilesQuota("user", project, model.ProjectFiles{
+		"a.go": "package a",
+		"b.go": "package b",
+	})
+	if !errors.As(err, &qe) || qe.StatusCode() != http.StatusForbidden {
+		t.Errorf("Expected too many files to be rejected, got %v", err)
+	}
+}
+
+func TestAllowStorage(t *testing.T) {
+	q := Quota{MaxStorage: 100}
+
+	if err := q.allowStorage(60, 40); err != nil {
+		t.Errorf("Expected storage up to the limit to be allowed, got %v", err)
+	}
+
+	if err := q.allowStorage(60, 41); err == nil {
+		t.Error("Expected storage over the limit to be rejected")
+	}
+
+	// a change which frees space is allowed even when the user is already over their limit
+	if err := q.allowStorage(150, -10); err != nil {
+		t.Errorf("Expected a change which frees space to be allowed, got %v", err)
+	}
+
+	if err := (Quota{}).allowStorage(1<<40, 1<<40); err != nil {
+		t.Errorf("Expected no limit when MaxStorage is 0, got %v", err)
+	}
+}
@@ -4,51 +4,52 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"io"
 	"path"
 	"strings"
-	"time"
 
 	"github.com/sammyhass/web-ide/server/db"
 	"github.com/sammyhass/web-ide/server/model"
-	"github.com/sammyhass/web-ide/server/s3"
+	"github.com/sammyhass/web-ide/server/storage"
 	"gorm.io/gorm"
 )
 
-// getProjectDir returns the path to the project directory as stored in the s3 bucket
+// getProjectDir returns the path to the project directory as held in storage
 func getProjectDir(userId string, id string) string {
 	return path.Join(userId, id)
 }
 
-// getProjectSrcDir returns the path to the project source directory as stored in the s3 bucket
+// getProjectSrcDir returns the path to the project source directory as held in storage
 func getProjectSrcDir(userId string, id string) string {
 	return path.Join(getProjectDir(userId, id), "src")
 }
 
-// getProjectWasmDir returns the path to the project wasm directory as stored in the s3 bucket
+// getProjectWasmDir returns the path to the project wasm directory as held in storage
 func getProjectWasmDir(userId string, id string) string {
 	return path.Join(getProjectDir(userId, id), "build")
 }
 
 type Repository struct {
-	db *gorm.DB
-	s3 *s3.Service
+	db      *gorm.DB
+	storage storage.Backend
+	quota   Quota // quota is checked again within the transaction of each change which adds to a user's storage
 }
 
-func newRepository() *Repository {
+func newRepository(quota Quota) *Repository {
 	return &Repository{
-		db: db.GetConnection(),
-		s3: s3.NewService(),
+		db:      db.GetConnection(),
+		storage: storage.NewBackend(),
+		quota:   quota,
 	}
 }
 
 /*
-createProject creates a new project in the database
+createProject creates a new project in the database, pinned to the given version of the compiler for its language
 */
 func (r *Repository) createProject(
 	name string,
 	userID string,
 	language model.ProjectLanguage,
+	compilerVersion string,
 ) (model.Project, error) {
 
 	proj := model.NewProject(
@@ -56,8 +57,15 @@ func (r *Repository) createProject(
 		userID,
 		language,
 	)
+	proj.CompilerVersion = compilerVersion
 
-	err := r.db.Create(&proj).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkProjectsWithin(tx, r.quota, userID); err != nil {
+			return err
+		}
+
+		return tx.Create(&proj).Error
+	})
 
 	if err != nil {
 		return model.Project{}, err
@@ -66,22 +74,31 @@ func (r *Repository) createProject(
 	return proj, nil
 }
 
-// createProjectFilesWith creates a project in the s3 bucket with the given files
+// createProjectFilesWith stores the given files as the contents of a project
 func (r *Repository) createProjectFilesWith(userId, projectId string, files model.ProjectFiles) (model.ProjectFiles, error) {
-	srcDir := getProjectSrcDir(userId, projectId)
-
 	if files == nil {
 		return nil, errors.New("invalid project language")
 	}
 
-	if err := r.s3.UploadFiles(srcDir, files); err != nil {
+	project, err := r.getProjectRecord(userId, projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := r.putBlobs(files)
+	if err != nil {
+		return nil, err
+	}
+
+	// the default files are small enough that a new project is never held back by the storage quota
+	if _, err := r.commitUnder(&project, "Created project", Quota{}, replaceWith(manifest)); err != nil {
 		return nil, err
 	}
 
 	return files, nil
 }
 
-// createProjectFiles creates a project in the s3 bucket with the default files for the given language
+// createProjectFiles creates a project in storage with the default files for the given language
 func (r *Repository) createProjectFiles(userId, projectId string, language model.ProjectLanguage) (model.ProjectFiles, error) {
 	var files model.ProjectFiles
 	switch language {
@@ -93,9 +110,7 @@ func (r *Repository) createProjectFiles(userId, projectId string, language model
 		return nil, errors.New("invalid project language")
 	}
 
-	r.createProjectFilesWith(userId, projectId, files)
-
-	return files, nil
+	return r.createProjectFilesWith(userId, projectId, files)
 }
 
 /*
@@ -137,7 +152,7 @@ func (r *Repository) getProjectRecord(
 }
 
 /*
-getProjectByID returns a project for a given user with the given id returning the view of the database record and the files in s3
+getProjectByID returns a project for a given user with the given id returning the view of the database record and the files in storage
 */
 func (r *Repository) getProjectByID(userId string, id string) (model.ProjectView, error) {
 
@@ -151,13 +166,21 @@ func (r *Repository) getProjectByID(userId string, id string) (model.ProjectView
 		return model.ProjectView{}, errors.New("project not found")
 	}
 
-	files, err := r.s3.GetFiles(getProjectSrcDir(userId, id))
+	files, err := r.getProjectFiles(&project)
 
 	if err != nil {
 		return model.ProjectView{}, err
 	}
 
-	return project.ViewWithFiles(files), nil
+	assets, err := r.getAssets(id)
+	if err != nil {
+		return model.ProjectView{}, err
+	}
+
+	v := project.ViewWithFiles(files)
+	v.Assets = model.AssetsToAssetViews(assets)
+
+	return v, nil
 }
 
 /*
@@ -177,79 +200,183 @@ func (r *Repository) deleteProject(userId string, id string) error {
 		return errors.New("project not found")
 	}
 
-	dbErr := r.db.Delete(&project).Error
+	dbErr := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&project).Error; err != nil {
+			return err
+		}
+
+		if err := deleteRevisions(tx, project.ID); err != nil {
+			return err
+		}
+
+		return releaseBlobs(tx, project.Manifest)
+	})
 	if dbErr != nil {
 		return dbErr
 	}
 
+	if err := r.deleteProjectAssets(id); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 /*
-deleteProjectFiles deletes a project stored in s3
+deleteProjectFiles deletes a project held in storage
 */
 func (r *Repository) deleteProjectFiles(userId string, id string) error {
 	dir := getProjectDir(userId, id)
-	s3Err := r.s3.DeleteDir(dir)
-	if s3Err != nil {
-		return s3Err
+	storageErr := r.storage.DeleteDir(dir)
+	if storageErr != nil {
+		return storageErr
 	}
 
 	return nil
 }
 
 /*
-updateProjectFiles updates the files for a given project in s3
+getProjectFiles returns the source files of a project, moving them into blob storage first if needed
 */
-func (r *Repository) uploadProjectSrcFiles(userId string, id string, files model.ProjectFiles) (
-	model.ProjectFiles,
-	error,
-) {
-	srcDir := getProjectSrcDir(userId, id)
-	err := r.s3.UploadFiles(srcDir, files)
+func (r *Repository) getProjectFiles(project *model.Project) (model.ProjectFiles, error) {
+	if project.Manifest == nil {
+		return r.importLegacyFiles(project)
+	}
+
+	return r.readBlobs(project.Manifest)
+}
+
+var errAlreadyImported = errors.New("project files have already been imported")
+
+/*
+importLegacyFiles moves the source files of a project created before files were stored as blobs out of the project
+source directory and into blob storage
+*/
+func (r *Repository) importLegacyFiles(project *model.Project) (model.ProjectFiles, error) {
+	srcDir := getProjectSrcDir(project.UserID, project.ID)
+
+	files, err := r.storage.GetFiles(srcDir)
 	if err != nil {
 		return nil, err
 	}
 
-	return files, nil
-}
+	manifest, err := r.putBlobs(files)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files were stored before they were imported so they aren't held to the quota
+	_, err = r.commitUnder(project, "Imported project files", Quota{}, func(head model.Manifest) (model.Manifest, error) {
+		if head != nil {
+			return nil, errAlreadyImported
+		}
+
+		return manifest, nil
+	})
+
+	// another request imported the files first, the source directory is theirs to clean up
+	if err == errAlreadyImported {
+		return r.readBlobs(project.Manifest)
+	}
 
-func (r *Repository) uploadBuildFile(userId string, id string, name string, file io.Reader) error {
-	wasmDir := getProjectWasmDir(userId, id)
-	_, err := r.s3.Upload(wasmDir, name, file)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	if err := r.storage.DeleteDir(srcDir); err != nil {
+		return nil, err
+	}
+
+	return files, nil
 }
 
-func (r *Repository) uploadProjectWasm(userId string, id string, file io.Reader) error {
-	return r.uploadBuildFile(userId, id, "main.wasm", file)
+// ensureManifest makes sure the files of a project are held in blob storage so that its manifest can be used
+func (r *Repository) ensureManifest(project *model.Project) error {
+	if project.Manifest != nil {
+		return nil
+	}
+
+	_, err := r.importLegacyFiles(project)
+	return err
 }
 
-func (r *Repository) genProjectWasmPresignedURL(userId string, id string) (string, error) {
-	wasmDir := getProjectWasmDir(userId, id)
-	url, err := r.s3.GenPresignedURL(path.Join(wasmDir, "main.wasm"), time.Hour*24*7)
+/*
+uploadProjectSrcFiles adds or replaces files in a project as a new revision, files which aren't given are left unchanged.
+The save is rejected with a conflictError unless base is the revision at the head of the project.
+*/
+func (r *Repository) uploadProjectSrcFiles(userId string, id string, files model.ProjectFiles, message string, base int) (
+	model.Revision,
+	model.ProjectFiles,
+	error,
+) {
+	project, err := r.getProjectRecord(userId, id)
 	if err != nil {
-		return "", err
+		return model.Revision{}, nil, err
 	}
 
-	return url, nil
-}
+	if err := r.ensureManifest(&project); err != nil {
+		return model.Revision{}, nil, err
+	}
 
-func (r *Repository) uploadProjectWat(userId string, id string, file io.Reader) error {
-	return r.uploadBuildFile(userId, id, "main.wat", file)
-}
+	// the blobs are staged before the head moves, a failed upload leaves them unreferenced and the project untouched
+	changed, err := r.putBlobs(files)
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	rev, err := r.commit(&project, message, func(head model.Manifest) (model.Manifest, error) {
+		if project.Revision != base {
+			return nil, errStaleRevision
+		}
+
+		return head.Merge(changed), nil
+	})
+
+	if err == errStaleRevision {
+		return model.Revision{}, nil, r.newConflictError(&project, base, changed)
+	}
 
-func (r *Repository) genProjectWatPresignedURL(userId string, id string) (string, error) {
-	wasmDir := getProjectWasmDir(userId, id)
-	url, err := r.s3.GenPresignedURL(path.Join(wasmDir, "main.wat"), time.Hour*24*7)
 	if err != nil {
-		return "", err
+		return model.Revision{}, nil, err
+	}
+
+	return rev, files, nil
+}
+
+/*
+copyProject creates a new project for a user with the same files as an existing project. The new project shares the
+blobs of the existing one so no files are copied in storage.
+*/
+func (r *Repository) copyProject(src *model.Project, userId, name string) (model.Project, error) {
+	if err := r.ensureManifest(src); err != nil {
+		return model.Project{}, err
+	}
+
+	proj := model.NewProject(name, userId, src.Language)
+	proj.BuildSettings = src.BuildSettings
+	proj.CompilerVersion = src.CompilerVersion
+
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkProjectsWithin(tx, r.quota, userId); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&proj).Error; err != nil {
+			return err
+		}
+
+		manifest := src.Manifest.Copy()
+		if err := checkManifestQuota(tx, r.quota, &proj, manifest); err != nil {
+			return err
+		}
+
+		_, err := commitManifest(tx, &proj, manifest, fmt.Sprintf("Copied from %s", src.Name))
+		return err
+	}); err != nil {
+		return model.Project{}, err
 	}
 
-	return url, nil
+	return proj, nil
 }
 
 func (r *Repository) renameProject(
@@ -261,9 +388,7 @@ func (r *Repository) renameProject(
 		return model.ProjectView{}, err
 	}
 
-	p.Name = name
-
-	if err := r.db.Save(&p).Error; err != nil {
+	if err := r.db.Model(&p).Update("name", name).Error; err != nil {
 		return model.ProjectView{}, err
 	}
 
@@ -277,7 +402,8 @@ func (r *Repository) allowSharing(p *model.Project) (sharecode string, err error
 		Valid:  true,
 	}
 	for {
-		if err := r.db.Save(p).Error; err != nil {
+		err := r.db.Model(p).Updates(map[string]interface{}{"is_shared": true, "share_code": p.ShareCode}).Error
+		if err != nil {
 			if strings.Contains(err.Error(), "duplicate") {
 				p.ShareCode = sql.NullString{
 					String: generateShareCode(),
@@ -322,18 +448,36 @@ func (r *Repository) disallowSharing(
 	return nil
 }
 
-// getProjectByShareCode returns the project with the given share code files included
-func (r *Repository) getProjectByShareCode(code string) (model.ProjectView, error) {
+// getSharedProjectRecord returns the database record of the project with the given share code
+func (r *Repository) getSharedProjectRecord(code string) (model.Project, error) {
 	var p model.Project
 	if err := r.db.Where("share_code = ? AND is_shared = ?", code, true).First(&p).Error; err != nil {
 		fmt.Println("getProjectByShareCodeError", err)
+		return model.Project{}, err
+	}
+
+	return p, nil
+}
+
+// getProjectByShareCode returns the project with the given share code files included
+func (r *Repository) getProjectByShareCode(code string) (model.ProjectView, error) {
+	p, err := r.getSharedProjectRecord(code)
+	if err != nil {
 		return model.ProjectView{}, err
 	}
 
-	files, err := r.s3.GetFiles(getProjectSrcDir(p.UserID, p.ID))
+	files, err := r.getProjectFiles(&p)
+	if err != nil {
+		return p.View(), err
+	}
+
+	assets, err := r.getAssets(p.ID)
 	if err != nil {
 		return p.View(), err
 	}
 
-	return p.ViewWithFiles(files), nil
+	v := p.ViewWithFiles(files)
+	v.Assets = model.AssetsToAssetViews(assets)
+
+	return v, nil
 }
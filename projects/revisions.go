@@ -0,0 +1,391 @@
+package projects
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sammyhass/web-ide/server/diff"
+	"github.com/sammyhass/web-ide/server/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errRevisionNotFound = errors.New("revision not found")
+
+var errStaleRevision = errors.New("project has been updated since the revision being saved")
+
+/*
+conflictError is returned when files are saved against a revision which is no longer the head of a project. Files holds
+the content at the head of every file the save changes which has also changed since the revision the save was based on.
+*/
+type conflictError struct {
+	Revision int
+	Files    model.ProjectFiles
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("project has been updated to revision %d since the revision being saved", e.Revision)
+}
+
+/*
+conflictingPaths returns the head of each path in changes which has changed between the base and the head, paths which
+have been removed at the head are left out
+*/
+func conflictingPaths(base, head, changes model.Manifest) model.Manifest {
+	conflicts := make(model.Manifest)
+	for p := range changes {
+		if h, ok := head[p]; ok && h != base[p] {
+			conflicts[p] = h
+		}
+	}
+
+	return conflicts
+}
+
+/*
+newConflictError describes the files which conflict with a save based on revision base, project must hold the head it
+was rejected by
+*/
+func (r *Repository) newConflictError(project *model.Project, base int, changes model.Manifest) error {
+	var baseManifest model.Manifest
+
+	rev, err := r.getRevision(project.ID, base)
+	if err == nil {
+		baseManifest = rev.Manifest
+	} else if err != errRevisionNotFound {
+		return err
+	}
+
+	files, err := r.readBlobs(conflictingPaths(baseManifest, project.Manifest, changes))
+	if err != nil {
+		return err
+	}
+
+	return &conflictError{
+		Revision: project.Revision,
+		Files:    files,
+	}
+}
+
+/*
+commitManifest records a new revision of a project with the given manifest and makes it the head of the project. The
+revision and the project each hold their own reference to the blobs in the manifest.
+*/
+func commitManifest(tx *gorm.DB, project *model.Project, manifest model.Manifest, message string) (model.Revision, error) {
+	rev := model.NewRevision(project.ID, project.Revision+1, message, manifest)
+
+	size, stored, err := addedSize(tx, project.Manifest, manifest)
+	if err != nil {
+		return model.Revision{}, err
+	}
+	rev.Size = size
+	rev.StoredSize = stored
+
+	if err := tx.Create(&rev).Error; err != nil {
+		return model.Revision{}, err
+	}
+
+	if err := retainBlobs(tx, manifest); err != nil {
+		return model.Revision{}, err
+	}
+
+	if err := replaceManifest(tx, project, manifest); err != nil {
+		return model.Revision{}, err
+	}
+
+	if err := tx.Model(project).Update("revision", rev.Number).Error; err != nil {
+		return model.Revision{}, err
+	}
+
+	project.Revision = rev.Number
+	return rev, nil
+}
+
+/*
+addedSize returns the number of bytes of content in the head manifest which isn't in the base manifest, along with the
+number of bytes the content takes in storage
+*/
+func addedSize(tx *gorm.DB, base, head model.Manifest) (int64, int64, error) {
+	inBase := make(map[string]bool, len(base))
+	for _, h := range base {
+		inBase[h] = true
+	}
+
+	var added []string
+	for _, h := range head.Hashes() {
+		if !inBase[h] {
+			added = append(added, h)
+		}
+	}
+
+	if len(added) == 0 {
+		return 0, 0, nil
+	}
+
+	var total sizes
+	err := tx.Model(&model.Blob{}).Where("hash IN ?", added).Select(sumSizes("blobs")).Scan(&total).Error
+
+	return total.Size, total.StoredSize, err
+}
+
+// manifestChange computes the manifest of a new revision from the manifest at the head of a project
+type manifestChange func(head model.Manifest) (model.Manifest, error)
+
+// replaceWith returns a change which replaces the head of a project with the given manifest
+func replaceWith(manifest model.Manifest) manifestChange {
+	return func(model.Manifest) (model.Manifest, error) {
+		return manifest, nil
+	}
+}
+
+/*
+lockProject reloads the head of a project and locks its row until the transaction ends, so that saves to the same
+project are applied one after another rather than overwriting each other
+*/
+func lockProject(tx *gorm.DB, project *model.Project) error {
+	var head model.Project
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("manifest", "revision").
+		Where("id = ?", project.ID).
+		First(&head).Error
+
+	if err != nil {
+		return err
+	}
+
+	project.Manifest = head.Manifest
+	project.Revision = head.Revision
+	return nil
+}
+
+/*
+commit stores a new revision of a project in its own transaction. The change is applied to the head of the project
+while its row is locked, and the head only moves to the new manifest once the transaction commits, so readers see
+either every file of a save or none of them.
+*/
+func (r *Repository) commit(project *model.Project, message string, change manifestChange) (model.Revision, error) {
+	return r.commitUnder(project, message, r.quota, change)
+}
+
+// commitUnder stores a new revision of a project like commit, rejecting the change if it goes over the given quota
+func (r *Repository) commitUnder(
+	project *model.Project,
+	message string,
+	quota Quota,
+	change manifestChange,
+) (model.Revision, error) {
+	var rev model.Revision
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProject(tx, project); err != nil {
+			return err
+		}
+
+		manifest, err := change(project.Manifest)
+		if err != nil {
+			return err
+		}
+
+		if err := checkManifestQuota(tx, quota, project, manifest); err != nil {
+			return err
+		}
+
+		rev, err = commitManifest(tx, project, manifest, message)
+		return err
+	})
+
+	return rev, err
+}
+
+/*
+deleteRevisions deletes every revision of a project, releasing the blobs they refer to
+*/
+func deleteRevisions(tx *gorm.DB, projectId string) error {
+	var revisions []model.Revision
+	if err := tx.Where("project_id = ?", projectId).Find(&revisions).Error; err != nil {
+		return err
+	}
+
+	for _, rev := range revisions {
+		if err := releaseBlobs(tx, rev.Manifest); err != nil {
+			return err
+		}
+	}
+
+	return tx.Where("project_id = ?", projectId).Delete(&model.Revision{}).Error
+}
+
+func (r *Repository) getRevisions(projectId string) ([]model.Revision, error) {
+	var revisions []model.Revision
+
+	if err := r.db.Where("project_id = ?", projectId).Order("number DESC").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (r *Repository) getRevision(projectId string, number int) (model.Revision, error) {
+	var rev model.Revision
+
+	err := r.db.Where("project_id = ? AND number = ?", projectId, number).First(&rev).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.Revision{}, errRevisionNotFound
+	}
+
+	if err != nil {
+		return model.Revision{}, err
+	}
+
+	return rev, nil
+}
+
+/*
+restoreRevision makes the files of a past revision the head of a project by recording them as a new revision, the
+revisions in between are kept. When base is given the restore is rejected with a conflictError unless base is the
+revision at the head of the project.
+*/
+func (r *Repository) restoreRevision(userId, id string, number int, base *int) (model.Revision, model.ProjectFiles, error) {
+	project, err := r.getProjectRecord(userId, id)
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	old, err := r.getRevision(id, number)
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	var touched model.Manifest
+
+	message := fmt.Sprintf("Restored revision %d", number)
+
+	rev, err := r.commit(&project, message, func(head model.Manifest) (model.Manifest, error) {
+		if base != nil && project.Revision != *base {
+			// every path which the restore would remove or replace is reported as a conflict
+			touched = make(model.Manifest)
+			for p, h := range head {
+				if old.Manifest[p] != h {
+					touched[p] = h
+				}
+			}
+
+			return nil, errStaleRevision
+		}
+
+		return old.Manifest.Copy(), nil
+	})
+
+	if err == errStaleRevision {
+		return model.Revision{}, nil, r.newConflictError(&project, *base, touched)
+	}
+
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	files, err := r.readBlobs(rev.Manifest)
+	if err != nil {
+		return model.Revision{}, nil, err
+	}
+
+	return rev, files, nil
+}
+
+/*
+diffManifests lists the files which differ between two manifests, along with the blobs of each side of the changed
+files keyed by a/<path> and b/<path>
+*/
+func diffManifests(a, b model.Manifest) ([]model.FileDiff, model.Manifest) {
+	changed := make(model.Manifest)
+	var files []model.FileDiff
+
+	paths := make(map[string]bool)
+	for p := range a {
+		paths[p] = true
+	}
+	for p := range b {
+		paths[p] = true
+	}
+
+	for p := range paths {
+		ha, inA := a[p]
+		hb, inB := b[p]
+
+		switch {
+		case !inA:
+			files = append(files, model.FileDiff{Path: p, Status: "added"})
+		case !inB:
+			files = append(files, model.FileDiff{Path: p, Status: "removed"})
+		case ha != hb:
+			files = append(files, model.FileDiff{Path: p, Status: "modified"})
+		default:
+			continue
+		}
+
+		if inA {
+			changed["a/"+p] = ha
+		}
+		if inB {
+			changed["b/"+p] = hb
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	return files, changed
+}
+
+// getDiffRevision returns a revision being compared, revision 0 is the empty project from before its first revision
+func (r *Repository) getDiffRevision(projectId string, number int) (model.Revision, error) {
+	if number == 0 {
+		return model.Revision{ProjectID: projectId}, nil
+	}
+
+	return r.getRevision(projectId, number)
+}
+
+/*
+diffRevisions compares the files of two revisions of a project, only the blobs of files which changed are read.
+Comparing with revision 0 shows every file of the other revision as added.
+*/
+func (r *Repository) diffRevisions(projectId string, from, to int) (model.RevisionDiff, error) {
+	a, err := r.getDiffRevision(projectId, from)
+	if err != nil {
+		return model.RevisionDiff{}, err
+	}
+
+	b, err := r.getDiffRevision(projectId, to)
+	if err != nil {
+		return model.RevisionDiff{}, err
+	}
+
+	files, changed := diffManifests(a.Manifest, b.Manifest)
+
+	contents, err := r.readBlobs(changed)
+	if err != nil {
+		return model.RevisionDiff{}, err
+	}
+
+	var unified string
+	for _, f := range files {
+		aName, bName := "a/"+f.Path, "b/"+f.Path
+		switch f.Status {
+		case "added":
+			aName = "/dev/null"
+		case "removed":
+			bName = "/dev/null"
+		}
+
+		unified += diff.Unified(aName, bName, contents["a/"+f.Path], contents["b/"+f.Path], diff.DefaultContext)
+	}
+
+	return model.RevisionDiff{
+		From:  from,
+		To:    to,
+		Files: files,
+		Diff:  unified,
+	}, nil
+}
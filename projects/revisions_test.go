@@ -0,0 +1,83 @@
+package projects
+
+import (
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestConflictingPaths(t *testing.T) {
+	base := model.Manifest{
+		"main.go":    model.HashContent("package main"),
+		"index.html": model.HashContent("<h1>Hello</h1>"),
+		"old.go":     model.HashContent("package old"),
+	}
+
+	head := model.Manifest{
+		"main.go":    model.HashContent("package main // theirs"),
+		"index.html": model.HashContent("<h1>Hello</h1>"),
+		"new.go":     model.HashContent("package new"),
+	}
+
+	changes := model.Manifest{
+		"main.go":    model.HashContent("package main // ours"),
+		"index.html": model.HashContent("<h1>Hi</h1>"),
+		"old.go":     model.HashContent("package old // ours"),
+		"new.go":     model.HashContent("package new // ours"),
+	}
+
+	got := conflictingPaths(base, head, changes)
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %v", got)
+	}
+
+	if got["main.go"] != head["main.go"] {
+		t.Error("Expected main.go to conflict with the head")
+	}
+
+	if got["new.go"] != head["new.go"] {
+		t.Error("Expected a file added at the head to conflict")
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	head := model.Manifest{
+		"main.go":    model.HashContent("package main"),
+		"lib/lib.go": model.HashContent("package lib"),
+	}
+
+	files, changed := diffManifests(nil, head)
+	if len(files) != 2 || files[0].Path != "lib/lib.go" || files[1].Path != "main.go" {
+		t.Fatalf("Expected both files to be listed in order, got %+v", files)
+	}
+
+	for _, f := range files {
+		if f.Status != "added" {
+			t.Errorf("Expected %s to be added when compared with an empty project, got %s", f.Path, f.Status)
+		}
+
+		if changed["b/"+f.Path] != head[f.Path] {
+			t.Errorf("Expected the blob of %s to be read", f.Path)
+		}
+	}
+
+	next := model.Manifest{
+		"main.go": model.HashContent("package main // changed"),
+		"new.go":  model.HashContent("package main"),
+	}
+
+	files, _ = diffManifests(head, next)
+
+	statuses := make(map[string]string)
+	for _, f := range files {
+		statuses[f.Path] = f.Status
+	}
+
+	want := map[string]string{"main.go": "modified", "lib/lib.go": "removed", "new.go": "added"}
+	for p, status := range want {
+		if statuses[p] != status {
+			t.Errorf("Expected %s to be %s, got %s", p, status, statuses[p])
+		}
+	}
+}
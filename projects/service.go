@@ -1,23 +1,28 @@
 package projects
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
-	"strings"
-	"sync"
+	"io"
+	"log"
 
 	"github.com/sammyhass/web-ide/server/model"
 	"github.com/sammyhass/web-ide/server/wasm"
 )
 
 type Service struct {
-	repo *Repository
+	repo  *Repository
+	quota Quota
+	// buildCacheSize is the most bytes of artifacts kept in the build cache, 0 when builds aren't cached
+	buildCacheSize int64
 }
 
 func NewService() *Service {
+	quota := quotaFromEnv()
+
 	return &Service{
-		repo: newRepository(),
+		repo:           newRepository(quota),
+		quota:          quota,
+		buildCacheSize: buildCacheSizeFromEnv(),
 	}
 }
 
@@ -26,7 +31,7 @@ func (s *Service) CreateProject(
 	userId string,
 	language model.ProjectLanguage,
 ) (model.ProjectView, error) {
-	proj, err := s.repo.createProject(name, userId, language)
+	proj, err := s.repo.createProject(name, userId, language, wasm.DefaultVersion(language))
 	if err != nil {
 		return model.ProjectView{}, err
 	}
@@ -58,95 +63,62 @@ func (s *Service) DeleteProjectByID(userId, id string) error {
 		return err
 	}
 
+	// sweep up any blobs which are no longer used by a project, this doesn't need to hold up the request
+	go func() {
+		if _, err := s.repo.reclaimBlobs(); err != nil {
+			log.Printf("[projects] Error reclaiming blobs: %v", err)
+		}
+	}()
+
 	return nil
 }
 
-func (s *Service) CompileProjectWASM(
+func (s *Service) UpdateProjectFiles(
 	userId string,
 	projectId string,
-) (string, error) {
-
-	proj, err := s.repo.getProjectByID(userId, projectId)
+	files model.ProjectFiles,
+	message string,
+	revision int,
+) (
+	model.RevisionView,
+	model.ProjectFiles,
+	error,
+) {
+	files, err := model.CleanProjectFiles(files)
 	if err != nil {
-		return "", err
-	}
-
-	var fname string
-	switch proj.Language {
-	case model.LanguageAssemblyScript.String():
-		fname = "main.ts"
-	case model.LanguageGo.String():
-		fname = "main.go"
-	default:
-		return "", errors.New("unsupported language")
+		return model.RevisionView{}, nil, err
 	}
 
-	mainFile, err := model.GetFileContent(proj.Files, fname)
+	proj, err := s.repo.getProjectRecord(userId, projectId)
 	if err != nil {
-		return "", err
+		return model.RevisionView{}, nil, err
 	}
 
-	res, err := wasm.Compile(
-		model.GetProjectLanguage(proj.Language),
-		mainFile,
-		wasm.CompileOpts{
-			GenWat: true,
-		},
-	)
-	if err != nil {
-		return "", err
+	// projects from before files were stored as blobs need their files imported before they can be compared
+	if err := s.repo.ensureManifest(&proj); err != nil {
+		return model.RevisionView{}, nil, err
 	}
 
-	var wg sync.WaitGroup
-	var uploadErrs []error
-
-	wg.Add(2)
-	wasmReader := bytes.NewReader(res.Wasm)
-
-	go func() {
-		defer wg.Done()
-
-		if err = s.repo.uploadProjectWasm(userId, projectId, wasmReader); err != nil {
-			uploadErrs = append(uploadErrs, err)
-			return
-		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		if err != nil {
-			uploadErrs = append(uploadErrs, err)
-			return
-		}
-		watReader := strings.NewReader(res.Wat)
-		if err = s.repo.uploadProjectWat(userId, projectId, watReader); err != nil {
-			uploadErrs = append(uploadErrs, err)
-			return
-		}
-	}()
-
-	wg.Wait()
+	if err := s.checkFilesQuota(userId, &proj, files); err != nil {
+		return model.RevisionView{}, nil, err
+	}
 
-	if len(uploadErrs) > 0 {
-		return "", uploadErrs[0]
+	rev, files, err := s.repo.uploadProjectSrcFiles(userId, projectId, files, message, revision)
+	if err != nil {
+		return model.RevisionView{}, nil, err
 	}
 
-	return s.repo.genProjectWasmPresignedURL(userId, projectId)
+	return rev.View(), files, nil
 }
 
-func (s *Service) UpdateProjectFiles(
-	userId string,
-	projectId string,
-	files model.ProjectFiles,
-) (
-	model.ProjectFiles,
-	error,
-) {
-	return s.repo.uploadProjectSrcFiles(userId, projectId, files)
-}
+// GetProjectTree returns the source files of a project arranged as a directory tree
+func (s *Service) GetProjectTree(userId, projectId string) (*model.FileTreeNode, error) {
+	proj, err := s.repo.getProjectByID(userId, projectId)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *Service) GenProjectWatPresignedURL(userId, projectId string) (string, error) {
-	return s.repo.genProjectWatPresignedURL(userId, projectId)
+	return model.BuildFileTree(model.FileViewsToProjectFiles(proj.Files)), nil
 }
 
 func (s *Service) RenameProject(userId, id, name string) (model.ProjectView, error) {
@@ -158,32 +130,174 @@ func (s *Service) ToggleForkable(userId, id string, share bool) (sharecode strin
 }
 
 func (s *Service) ForkProject(userId, sharecode string) (model.ProjectView, error) {
-	sharedProject, err := s.repo.getProjectByShareCode(sharecode)
+	sharedProject, err := s.repo.getSharedProjectRecord(sharecode)
+	if err != nil {
+		return model.ProjectView{}, err
+	}
+
+	return s.copyProject(&sharedProject, userId, fmt.Sprintf("%s (fork)", sharedProject.Name))
+}
+
+// DuplicateProject creates a copy of one of a user's own projects
+func (s *Service) DuplicateProject(userId, projectId string) (model.ProjectView, error) {
+	proj, err := s.repo.getProjectRecord(userId, projectId)
 	if err != nil {
 		return model.ProjectView{}, err
 	}
 
-	newProj, err := s.repo.createProject(
-		fmt.Sprintf("%s (fork)", sharedProject.Name),
-		userId,
-		model.GetProjectLanguage(sharedProject.Language),
-	)
+	return s.copyProject(&proj, userId, fmt.Sprintf("%s (copy)", proj.Name))
+}
+
+func (s *Service) copyProject(src *model.Project, userId, name string) (model.ProjectView, error) {
+	size, err := s.repo.getProjectSize(src)
 	if err != nil {
 		return model.ProjectView{}, err
 	}
 
-	files, err := s.repo.createProjectFilesWith(
-		userId,
-		newProj.ID,
-		model.FileViewsToProjectFiles(sharedProject.Files),
-	)
+	if err := s.checkStorageQuota(userId, size); err != nil {
+		return model.ProjectView{}, err
+	}
+
+	newProj, err := s.repo.copyProject(src, userId, name)
 	if err != nil {
 		return model.ProjectView{}, err
 	}
 
-	return newProj.ViewWithFiles(files), nil
+	assets, err := s.repo.copyAssets(src.UserID, src.ID, userId, newProj.ID)
+	if err != nil {
+		return model.ProjectView{}, err
+	}
+
+	files, err := s.repo.getProjectFiles(&newProj)
+	if err != nil {
+		return model.ProjectView{}, err
+	}
+
+	v := newProj.ViewWithFiles(files)
+	v.Assets = model.AssetsToAssetViews(assets)
+
+	return v, nil
 }
 
 func (s *Service) GetSharedProject(sharecode string) (model.ProjectView, error) {
 	return s.repo.getProjectByShareCode(sharecode)
 }
+
+// UploadAsset stores a binary asset in a project, replacing any existing asset at the same path
+func (s *Service) UploadAsset(
+	userId, projectId, assetPath, contentType string,
+	size int64,
+	body io.Reader,
+) (model.AssetView, error) {
+	p, err := model.CleanFilePath(assetPath)
+	if err != nil {
+		return model.AssetView{}, err
+	}
+
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return model.AssetView{}, err
+	}
+
+	asset, err := s.repo.uploadAsset(userId, projectId, p, contentType, size, body)
+	if err != nil {
+		return model.AssetView{}, err
+	}
+
+	return asset.View(), nil
+}
+
+func (s *Service) GetAssets(userId, projectId string) ([]model.AssetView, error) {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return nil, err
+	}
+
+	assets, err := s.repo.getAssets(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	return model.AssetsToAssetViews(assets), nil
+}
+
+// OpenAsset returns an asset along with a reader streaming its contents, which must be closed by the caller
+func (s *Service) OpenAsset(userId, projectId, assetPath string) (model.AssetView, io.ReadCloser, error) {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return model.AssetView{}, nil, err
+	}
+
+	asset, err := s.repo.getAsset(projectId, assetPath)
+	if err != nil {
+		return model.AssetView{}, nil, err
+	}
+
+	body, err := s.repo.openAsset(userId, projectId, asset)
+	if err != nil {
+		return model.AssetView{}, nil, err
+	}
+
+	return asset.View(), body, nil
+}
+
+func (s *Service) DeleteAsset(userId, projectId, assetPath string) error {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return err
+	}
+
+	return s.repo.deleteAsset(userId, projectId, assetPath)
+}
+
+func (s *Service) GetRevisions(userId, projectId string) ([]model.RevisionView, error) {
+	if _, err := s.repo.getProjectRecord(userId, projectId); err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.repo.getRevisions(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]model.RevisionView, len(revisions))
+	for i := range revisions {
+		views[i] = revisions[i].View()
+	}
+
+	return views, nil
+}
+
+/*
+DiffRevisions returns a unified diff between two revisions of a project. When to is 0 the head revision is used and
+when from is 0 the revision before to is used.
+*/
+func (s *Service) DiffRevisions(userId, projectId string, from, to int) (model.RevisionDiff, error) {
+	proj, err := s.repo.getProjectRecord(userId, projectId)
+	if err != nil {
+		return model.RevisionDiff{}, err
+	}
+
+	if to == 0 {
+		to = proj.Revision
+	}
+
+	if from == 0 {
+		from = to - 1
+	}
+
+	return s.repo.diffRevisions(projectId, from, to)
+}
+
+/*
+RestoreRevision restores the files of a past revision as the new head of a project, the restore is checked against the
+head of the project when revision is given
+*/
+func (s *Service) RestoreRevision(userId, projectId string, number int, revision *int) (
+	model.RevisionView,
+	[]model.FileView,
+	error,
+) {
+	rev, files, err := s.repo.restoreRevision(userId, projectId, number, revision)
+	if err != nil {
+		return model.RevisionView{}, nil, err
+	}
+
+	return rev.View(), model.ProjectFilesToFileViews(files), nil
+}
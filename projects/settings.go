@@ -0,0 +1,69 @@
+package projects
+
+import (
+	"net/http"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/wasm"
+)
+
+// settingsError is returned when build settings aren't allowed for a project
+type settingsError struct {
+	err error
+}
+
+func (e *settingsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *settingsError) Unwrap() error {
+	return e.err
+}
+
+func (e *settingsError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (r *Repository) setBuildSettings(projectId string, settings model.BuildSettings) error {
+	return r.db.Model(&model.Project{}).Where("id = ?", projectId).Update("build_settings", settings).Error
+}
+
+// GetBuildSettings returns the build settings of one of a user's projects
+func (s *Service) GetBuildSettings(userId, projectId string) (model.BuildSettings, error) {
+	proj, err := s.repo.getProjectRecord(userId, projectId)
+	if err != nil {
+		return model.BuildSettings{}, err
+	}
+
+	return proj.BuildSettings, nil
+}
+
+/*
+UpdateBuildSettings replaces the build settings of one of a user's projects, the settings must be allowed for the
+language of the project and the version of the compiler it is pinned to, or the default version if it isn't pinned yet.
+The new settings are used from the next time the project is compiled.
+*/
+func (s *Service) UpdateBuildSettings(
+	userId, projectId string,
+	settings model.BuildSettings,
+) (model.BuildSettings, error) {
+	proj, err := s.repo.getProjectRecord(userId, projectId)
+	if err != nil {
+		return model.BuildSettings{}, err
+	}
+
+	version := proj.CompilerVersion
+	if version == "" {
+		version = wasm.DefaultVersion(proj.Language)
+	}
+
+	if err := wasm.ValidateSettings(proj.Language, version, settings); err != nil {
+		return model.BuildSettings{}, &settingsError{err}
+	}
+
+	if err := s.repo.setBuildSettings(proj.ID, settings); err != nil {
+		return model.BuildSettings{}, err
+	}
+
+	return settings, nil
+}
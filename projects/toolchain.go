@@ -0,0 +1,99 @@
+package projects
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/wasm"
+)
+
+// compilerVersion matches the versions a project can be pinned to, such as 0.26.0
+var compilerVersion = regexp.MustCompile(`^[0-9A-Za-z.+-]{1,64}$`)
+
+// versionError is returned when a project can't be pinned to the version of the compiler asked for
+type versionError struct {
+	err error
+}
+
+func (e *versionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *versionError) Unwrap() error {
+	return e.err
+}
+
+func (e *versionError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (r *Repository) setCompilerVersion(projectId, version string) error {
+	return r.db.Model(&model.Project{}).Where("id = ?", projectId).Update("compiler_version", version).Error
+}
+
+/*
+pinCompilerVersion returns the version of its compiler a project is built with. Projects which aren't pinned, because
+they were created before versions were pinned or by an instance without the compiler, are pinned to the default version
+the first time they are built.
+*/
+func (s *Service) pinCompilerVersion(projectId string, language model.ProjectLanguage, version string) (string, error) {
+	if version != "" {
+		return version, nil
+	}
+
+	version = wasm.DefaultVersion(language)
+	if version == "" {
+		// nothing is installed, so the build fails with the toolchain reported as unavailable
+		return "", nil
+	}
+
+	return version, s.repo.setCompilerVersion(projectId, version)
+}
+
+/*
+UpgradeCompiler pins one of a user's projects to a version of the compiler for its language, or to the default version
+when version is empty. The project's build settings must be allowed for the version. The version must be installed
+when this instance runs workers, otherwise the compilers are on other instances and a version which isn't installed is
+reported when the project is built.
+*/
+func (s *Service) UpgradeCompiler(userId, projectId, version string) (model.ProjectView, error) {
+	proj, err := s.repo.getProjectRecord(userId, projectId)
+	if err != nil {
+		return model.ProjectView{}, err
+	}
+
+	if localWorkers > 0 {
+		if version == "" {
+			version = wasm.DefaultVersion(proj.Language)
+		}
+
+		if err := wasm.CheckToolchain(proj.Language, version); err != nil {
+			var unavailable *wasm.UnavailableError
+			if errors.As(err, &unavailable) && unavailable.Version != "" {
+				return model.ProjectView{}, &versionError{err}
+			}
+
+			return model.ProjectView{}, &toolchainError{err}
+		}
+	} else if version == "" {
+		return model.ProjectView{}, &versionError{errors.New("a version must be given as the compilers aren't installed on this server")}
+	}
+
+	if !compilerVersion.MatchString(version) {
+		return model.ProjectView{}, &versionError{errors.New("invalid version")}
+	}
+
+	// the project's settings have to keep working with the version it moves to
+	if err := wasm.ValidateSettings(proj.Language, version, proj.BuildSettings); err != nil {
+		return model.ProjectView{}, &settingsError{err}
+	}
+
+	if err := s.repo.setCompilerVersion(proj.ID, version); err != nil {
+		return model.ProjectView{}, err
+	}
+
+	proj.CompilerVersion = version
+	return proj.View(), nil
+}
@@ -1,17 +1,32 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// statusError is implemented by errors which should be reported to the client with their own status code
+type statusError interface {
+	error
+	StatusCode() int
+}
+
 func ErrorHandler(c *gin.Context) {
 	c.Next()
 
 	msgs := []string{}
 	for _, err := range c.Errors {
+		var se statusError
+		if errors.As(err.Err, &se) && !c.Writer.Written() {
+			c.JSON(se.StatusCode(), gin.H{
+				"error": se.Error(),
+			})
+			return
+		}
+
 		fmt.Println("Error: ", err.Error())
 		msgs = append(msgs, err.Error())
 	}
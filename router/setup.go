@@ -3,6 +3,8 @@ package router
 import (
 	"github.com/sammyhass/web-ide/server/auth"
 	"github.com/sammyhass/web-ide/server/projects"
+	"github.com/sammyhass/web-ide/server/storage"
+	"github.com/sammyhass/web-ide/server/wasm"
 )
 
 func Run(
@@ -12,6 +14,9 @@ func Run(
 
 	router.useController("/auth", auth.NewController())
 	router.useController("/projects", projects.NewController())
+	router.useController("/storage", storage.NewController())
+	router.useController("/me", projects.NewUsageController())
+	router.useController("/toolchains", wasm.NewController())
 
 	router.middleware()
 	router.routes()
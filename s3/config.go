@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sammyhass/web-ide/server/env"
+)
+
+const defaultRegion = "eu-west-2"
+
+// Config holds the settings used to reach an S3 compatible service (AWS, MinIO, Ceph, R2, LocalStack...)
+type Config struct {
+	Bucket         string
+	Endpoint       string // Endpoint overrides the default AWS endpoint when set
+	Region         string
+	ForcePathStyle bool   // ForcePathStyle uses bucket/key style URLs rather than virtual hosted buckets
+	SSE            string // SSE is the server-side encryption algorithm applied to uploads (AES256 or aws:kms), empty for none
+	SSEKMSKeyID    string // SSEKMSKeyID is the KMS key used when SSE is aws:kms
+	KeyPrefix      string // KeyPrefix is prepended to every key so that deployments can share a bucket
+}
+
+// ConfigFromEnv reads the s3 configuration from the environment
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Bucket:      env.Get(env.S3_BUCKET),
+		Endpoint:    env.Get(env.OPT_S3_ENDPOINT),
+		Region:      env.GetOr(env.OPT_S3_REGION, defaultRegion),
+		SSE:         env.Get(env.OPT_S3_SSE),
+		SSEKMSKeyID: env.Get(env.OPT_S3_SSE_KMS_KEY_ID),
+		KeyPrefix:   strings.Trim(env.Get(env.OPT_S3_KEY_PREFIX), "/"),
+	}
+
+	if v := env.Get(env.OPT_S3_FORCE_PATH_STYLE); v != "" {
+		forcePathStyle, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid value for %s: %s", env.OPT_S3_FORCE_PATH_STYLE, v)
+		}
+		cfg.ForcePathStyle = forcePathStyle
+	}
+
+	switch cfg.SSE {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms:
+	default:
+		return Config{}, fmt.Errorf("invalid value for %s: %s", env.OPT_S3_SSE, cfg.SSE)
+	}
+
+	if cfg.SSEKMSKeyID != "" && cfg.SSE != s3.ServerSideEncryptionAwsKms {
+		return Config{}, fmt.Errorf("%s requires %s to be %s", env.OPT_S3_SSE_KMS_KEY_ID, env.OPT_S3_SSE, s3.ServerSideEncryptionAwsKms)
+	}
+
+	return cfg, nil
+}
+
+// key converts a path into the key used in the bucket
+func (c Config) key(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if c.KeyPrefix == "" {
+		return path
+	}
+
+	return c.KeyPrefix + "/" + path
+}
+
+// dirKey converts a directory path into the prefix shared by every key inside of it
+func (c Config) dirKey(dir string) string {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return c.key("")
+	}
+
+	return c.key(dir) + "/"
+}
+
+// path converts a key in the bucket back to the path it was stored with
+func (c Config) path(key string) string {
+	if c.KeyPrefix == "" {
+		return key
+	}
+
+	return strings.TrimPrefix(key, c.KeyPrefix+"/")
+}
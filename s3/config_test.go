@@ -0,0 +1,40 @@
+package s3
+
+import "testing"
+
+func TestConfig_KeyWithoutPrefix(t *testing.T) {
+	cfg := Config{}
+
+	if k := cfg.key("user/project/src/main.go"); k != "user/project/src/main.go" {
+		t.Errorf("Expected key to be unchanged, got %s", k)
+	}
+
+	if p := cfg.path("user/project/src/main.go"); p != "user/project/src/main.go" {
+		t.Errorf("Expected path to be unchanged, got %s", p)
+	}
+}
+
+func TestConfig_KeyWithPrefix(t *testing.T) {
+	cfg := Config{KeyPrefix: "staging"}
+
+	k := cfg.key("user/project/src/main.go")
+	if k != "staging/user/project/src/main.go" {
+		t.Errorf("Expected key to be prefixed, got %s", k)
+	}
+
+	if p := cfg.path(k); p != "user/project/src/main.go" {
+		t.Errorf("Expected prefix to be removed, got %s", p)
+	}
+}
+
+func TestConfig_DirKey(t *testing.T) {
+	cfg := Config{KeyPrefix: "staging"}
+
+	if k := cfg.dirKey("user/project/src"); k != "staging/user/project/src/" {
+		t.Errorf("Expected directory key to end with a slash, got %s", k)
+	}
+
+	if k := cfg.dirKey("user/project/src/"); k != "staging/user/project/src/" {
+		t.Errorf("Expected a single trailing slash, got %s", k)
+	}
+}
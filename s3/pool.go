@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"fmt"
+	"sync"
+)
+
+// maxWorkers is the number of requests a single operation will make to s3 at once
+const maxWorkers = 16
+
+// deleteBatchSize is the maximum number of keys which can be deleted in a single DeleteObjects request
+const deleteBatchSize = 1000
+
+/*
+forEach calls fn for each of the items using a fixed pool of workers. Once any call has failed no further items are
+started, the error returned describes the first failure along with how many others occurred.
+*/
+func forEach[T any](items []T, workers int, fn func(item T) error) error {
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	jobs := make(chan T)
+	failed := make(chan struct{})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				if err := fn(item); err != nil {
+					mu.Lock()
+					if len(errs) == 0 {
+						close(failed)
+					}
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, item := range items {
+		select {
+		case jobs <- item:
+		case <-failed:
+			break dispatch
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%w (and %d other errors)", errs[0], len(errs)-1)
+	}
+}
+
+// batches splits items into consecutive slices with at most size items in each
+func batches[T any](items []T, size int) [][]T {
+	var out [][]T
+	for size < len(items) {
+		items, out = items[size:], append(out, items[:size])
+	}
+
+	if len(items) > 0 {
+		out = append(out, items)
+	}
+
+	return out
+}
@@ -0,0 +1,93 @@
+package s3
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach_ProcessesEveryItem(t *testing.T) {
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+
+	err := forEach(items, 8, func(item int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[item] = true
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != len(items) {
+		t.Errorf("Expected %d items to be processed, got %d", len(items), len(seen))
+	}
+}
+
+func TestForEach_BoundsConcurrency(t *testing.T) {
+	var running, peak int32
+
+	err := forEach(make([]int, 50), 4, func(int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peak > 4 {
+		t.Errorf("Expected at most 4 concurrent calls, got %d", peak)
+	}
+}
+
+func TestForEach_ReturnsErrorsWithoutDeadlocking(t *testing.T) {
+	errFailed := errors.New("failed")
+	done := make(chan error)
+
+	go func() {
+		done <- forEach(make([]int, 100), 4, func(int) error {
+			return errFailed
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errFailed) {
+			t.Errorf("Expected the first error to be returned, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("forEach did not return after an error")
+	}
+}
+
+func TestBatches(t *testing.T) {
+	b := batches(make([]int, 2500), 1000)
+
+	if len(b) != 3 || len(b[0]) != 1000 || len(b[1]) != 1000 || len(b[2]) != 500 {
+		t.Errorf("Unexpected batch sizes")
+	}
+
+	if len(batches([]int{}, 1000)) != 0 {
+		t.Errorf("Expected no batches for no items")
+	}
+}
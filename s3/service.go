@@ -2,161 +2,276 @@ package s3
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime"
-	"path/filepath"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/sammyhass/web-ide/server/compress"
 	"github.com/sammyhass/web-ide/server/env"
 	"github.com/sammyhass/web-ide/server/model"
 )
 
 var currentSession *session.Session
+var currentConfig Config
 
 func InitSession() {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("eu-west-2"),
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	awsCfg := &aws.Config{
+		Region: aws.String(cfg.Region),
 		Credentials: credentials.NewStaticCredentials(
 			env.Get(env.S3_ACCESS_KEY_ID),
 			env.Get(env.S3_SECRET_ACCESS_KEY),
 			"",
 		),
-	})
+		S3ForcePathStyle: aws.Bool(cfg.ForcePathStyle),
+	}
+
+	if cfg.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(cfg.Endpoint)
+	}
+
+	sess, err := session.NewSession(awsCfg)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	currentSession = sess
+	currentConfig = cfg
 }
 
 type Service struct {
 	uploader *s3manager.Uploader
 	s3       *s3.S3
+	config   Config
 }
 
 func NewService() *Service {
 	return &Service{
 		uploader: s3manager.NewUploader(currentSession),
 		s3:       s3.New(currentSession),
+		config:   currentConfig,
 	}
 }
 
+/*
+UploadFile uploads a source file, source files are always compressed
+*/
 func (svc *Service) UploadFile(
 	dir, fileName, content string,
-) (string, error) {
-	loc, err := svc.Upload(dir, fileName, strings.NewReader(content))
-
-	if err != nil {
-		return "", err
-	}
-
-	return loc, nil
+) (model.ObjectInfo, error) {
+	return svc.upload(dir, fileName, compress.ContentType(fileName), true, strings.NewReader(content))
 }
 
 func (svc *Service) Upload(
 	dir, fileName string,
 	r io.Reader,
-) (string, error) {
-	out, err := svc.uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(env.Get(env.S3_BUCKET)),
+) (model.ObjectInfo, error) {
+	return svc.UploadWithContentType(dir, fileName, compress.ContentType(fileName), r)
+}
+
+/*
+UploadWithContentType uploads a file with an explicit content type, which is returned when the file is downloaded.
+Files with a compressible content type are stored compressed.
+*/
+func (svc *Service) UploadWithContentType(
+	dir, fileName, contentType string,
+	r io.Reader,
+) (model.ObjectInfo, error) {
+	return svc.upload(dir, fileName, contentType, compress.Compressible(contentType), r)
+}
+
+/*
+upload stores a file in the bucket, compressed files are stored with a Content-Encoding so that presigned downloads are
+decompressed by the browser
+*/
+func (svc *Service) upload(
+	dir, fileName, contentType string,
+	compressed bool,
+	r io.Reader,
+) (model.ObjectInfo, error) {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(svc.config.Bucket),
 		Key: aws.String(
-			fmt.Sprintf("%s/%s", dir, fileName),
+			svc.config.key(fmt.Sprintf("%s/%s", dir, fileName)),
 		),
-		Body: r,
-	})
+	}
 
-	if err != nil {
-		return "", err
+	info := model.ObjectInfo{ContentType: contentType}
+	var counter *countingReader
+
+	if compressed {
+		encoded, size, err := compress.Encode(r)
+		if err != nil {
+			return model.ObjectInfo{}, err
+		}
+
+		input.Body = bytes.NewReader(encoded)
+		input.ContentEncoding = aws.String(compress.Gzip)
+		input.Metadata = map[string]*string{
+			sizeMetadataKey: aws.String(strconv.FormatInt(size, 10)),
+		}
+
+		info.Size = size
+		info.StoredSize = int64(len(encoded))
+		info.ContentEncoding = compress.Gzip
+	} else {
+		counter = &countingReader{r: r}
+		input.Body = counter
+	}
+
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
 	}
 
-	return out.Location, nil
+	if svc.config.SSE != "" {
+		input.ServerSideEncryption = aws.String(svc.config.SSE)
+	}
+
+	if svc.config.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(svc.config.SSEKMSKeyID)
+	}
+
+	if _, err := svc.uploader.Upload(input); err != nil {
+		return model.ObjectInfo{}, err
+	}
+
+	if counter != nil {
+		info.Size = counter.n
+		info.StoredSize = counter.n
+	}
+
+	return info, nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 /*
-GetFiles gets a map of files contained in a directory in the s3 bucket
+listKeys returns every key in the bucket beginning with prefix, following continuation tokens until the listing is
+complete
 */
-func (svc *Service) GetFiles(dir string) (map[string]string, error) {
-	res, err := svc.s3.ListObjects(&s3.ListObjectsInput{
-		Bucket: aws.String(env.Get(env.S3_BUCKET)),
-		Prefix: aws.String(dir),
+func (svc *Service) listKeys(prefix string) ([]string, error) {
+	var keys []string
+
+	err := svc.s3.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(svc.config.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		return true
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	files := make(map[string]string)
+	return keys, nil
+}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
+/*
+List returns the path of every file in a directory in the s3 bucket relative to the directory
+*/
+func (svc *Service) List(dir string) ([]string, error) {
+	prefix := svc.config.dirKey(dir)
+	keys, err := svc.listKeys(prefix)
+	if err != nil {
+		return nil, err
+	}
 
-	errs := make(chan error)
+	paths := make([]string, 0, len(keys))
+	for _, key := range keys {
+		p := strings.TrimPrefix(key, prefix)
+		if p == "" || strings.HasSuffix(p, "/") {
+			continue
+		}
+		paths = append(paths, p)
+	}
 
-	wg.Add(len(res.Contents))
+	return paths, nil
+}
 
-	for _, obj := range res.Contents {
-		go func(obj *s3.Object) {
-			defer wg.Done()
+/*
+GetFiles gets a map of files contained in a directory in the s3 bucket, keyed by their path relative to the directory
+*/
+func (svc *Service) GetFiles(dir string) (map[string]string, error) {
+	prefix := svc.config.dirKey(dir)
+	keys, err := svc.listKeys(prefix)
+	if err != nil {
+		return nil, err
+	}
 
-			content, err := svc.GetFile(*obj.Key)
+	files := make(map[string]string)
+	var mu sync.Mutex
 
-			if err != nil {
-				errs <- err
-				return
-			}
+	err = forEach(keys, maxWorkers, func(key string) error {
+		// keep the path relative to the directory so nested files are not flattened
+		fileName := strings.TrimPrefix(key, prefix)
+		if fileName == "" || strings.HasSuffix(fileName, "/") {
+			return nil
+		}
 
-			// get file name from key at the last index
-			spl := strings.Split(*obj.Key, "/")
-			fileName := spl[len(spl)-1]
-			if fileName == "" {
-				return
-			}
+		content, err := svc.GetFile(svc.config.path(key))
+		if err != nil {
+			return err
+		}
 
-			mu.Lock()
-			defer mu.Unlock()
-			files[fileName] = content
-		}(obj)
-	}
+		mu.Lock()
+		defer mu.Unlock()
+		files[fileName] = content
 
-	wg.Wait()
-	close(errs)
+		return nil
+	})
 
-	for err := range errs {
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return nil, err
 	}
 
 	return files, nil
 }
 
-func (svc *Service) Get(path string) (io.Reader, error) {
-	downloader := s3manager.NewDownloader(currentSession)
-
-	buf := aws.NewWriteAtBuffer([]byte{})
-
-	_, err := downloader.Download(buf, &s3.GetObjectInput{
-		Bucket: aws.String(env.Get(env.S3_BUCKET)),
-		Key:    aws.String(path),
+/*
+Get streams a file from s3 as it is downloaded, compressed files are decompressed while they are read. The body of the
+response is held open until the returned reader is closed.
+*/
+func (svc *Service) Get(path string) (io.ReadCloser, error) {
+	out, err := svc.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(svc.config.Bucket),
+		Key:    aws.String(svc.config.key(path)),
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	r := bytes.NewReader(buf.Bytes())
-
-	return r, nil
+	return compress.DecodeCloser(aws.StringValue(out.ContentEncoding), out.Body)
 }
 
 func (svc *Service) GetFile(path string) (string, error) {
@@ -166,94 +281,196 @@ func (svc *Service) GetFile(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer r.Close()
 
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(r)
-	if err != nil {
+	var sb strings.Builder
+	if _, err := io.Copy(&sb, r); err != nil {
 		return "", err
 	}
 
-	return buf.String(), nil
+	return sb.String(), nil
 }
 
+// sizeMetadataKey is the metadata holding the original size of a compressed object
+const sizeMetadataKey = "Size"
+
 /*
-DeleteDir deletes all the files in a directory in s3.
+Stat describes an object in s3 without downloading it
 */
-func (svc *Service) DeleteDir(dir string) error {
-	res, err := svc.s3.ListObjects(&s3.ListObjectsInput{
-		Bucket: aws.String(env.Get(env.S3_BUCKET)),
-		Prefix: aws.String(dir),
+func (svc *Service) Stat(path string) (model.ObjectInfo, error) {
+	out, err := svc.s3.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(svc.config.Bucket),
+		Key:    aws.String(svc.config.key(path)),
 	})
 
 	if err != nil {
-		return err
+		return model.ObjectInfo{}, err
+	}
+
+	info := model.ObjectInfo{
+		Size:            aws.Int64Value(out.ContentLength),
+		StoredSize:      aws.Int64Value(out.ContentLength),
+		ContentType:     aws.StringValue(out.ContentType),
+		ContentEncoding: aws.StringValue(out.ContentEncoding),
+		ETag:            strings.Trim(aws.StringValue(out.ETag), `"`),
+		ModTime:         aws.TimeValue(out.LastModified),
+	}
+
+	if size, ok := out.Metadata[sizeMetadataKey]; ok {
+		if n, err := strconv.ParseInt(aws.StringValue(size), 10, 64); err == nil {
+			info.Size = n
+		}
 	}
 
-	var wg sync.WaitGroup
-	errs := make(chan error)
+	return info, nil
+}
 
-	wg.Add(len(res.Contents))
+/*
+GetRange downloads part of an object in s3 as it is stored. Range requests are never decompressed in transit so
+compressed objects are returned compressed.
+*/
+func (svc *Service) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	out, err := svc.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(svc.config.Bucket),
+		Key:    aws.String(svc.config.key(path)),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
 
-	for _, obj := range res.Contents {
-		go func(obj *s3.Object) {
-			defer wg.Done()
-			if _, err := svc.s3.DeleteObject(
-				&s3.DeleteObjectInput{
-					Bucket: aws.String(env.Get(env.S3_BUCKET)),
-					Key:    obj.Key,
-				},
-			); err != nil {
-				errs <- err
-			}
-		}(obj)
+	if err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
-	close(errs)
+	return out.Body, nil
+}
 
-	for err := range errs {
-		if err != nil {
-			return err
-		}
+// IsNotFound reports whether an error was caused by an object not existing
+func IsNotFound(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+
+	switch aerr.Code() {
+	case s3.ErrCodeNoSuchKey, "NotFound":
+		return true
+	}
+
+	return false
+}
+
+/*
+DeleteDir deletes all the files in a directory in s3.
+*/
+func (svc *Service) DeleteDir(dir string) error {
+	keys, err := svc.listKeys(svc.config.dirKey(dir))
+	if err != nil {
+		return err
+	}
+
+	return forEach(batches(keys, deleteBatchSize), maxWorkers, svc.deleteKeys)
+}
+
+// deleteKeys deletes a batch of at most deleteBatchSize keys with a single request
+func (svc *Service) deleteKeys(keys []string) error {
+	objects := make([]*s3.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+	}
+
+	out, err := svc.s3.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String(svc.config.Bucket),
+		Delete: &s3.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(out.Errors) > 0 {
+		first := out.Errors[0]
+		return fmt.Errorf(
+			"failed to delete %d objects, %s: %s",
+			len(out.Errors),
+			aws.StringValue(first.Key),
+			aws.StringValue(first.Message),
+		)
 	}
 
 	return nil
 }
 
-func (svc *Service) UploadFiles(dir string, files model.ProjectFiles) error {
-	var wg sync.WaitGroup
+/*
+Copy copies an object within the bucket, keeping its encoding and metadata
+*/
+func (svc *Service) Copy(src, dest string) (model.ObjectInfo, error) {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(svc.config.Bucket),
+		CopySource: aws.String((&url.URL{Path: svc.config.Bucket + "/" + svc.config.key(src)}).EscapedPath()),
+		Key:        aws.String(svc.config.key(dest)),
+	}
 
-	errs := make(chan error)
+	if svc.config.SSE != "" {
+		input.ServerSideEncryption = aws.String(svc.config.SSE)
+	}
 
-	wg.Add(len(files))
+	if svc.config.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(svc.config.SSEKMSKeyID)
+	}
 
-	for name, content := range files {
-		go func(name, content string) {
-			defer wg.Done()
-			_, err := svc.UploadFile(dir, name, content)
-			if err != nil {
-				errs <- err
-			}
-		}(name, content)
+	if _, err := svc.s3.CopyObject(input); err != nil {
+		return model.ObjectInfo{}, err
 	}
 
-	wg.Wait()
-	close(errs)
+	return svc.Stat(dest)
+}
+
+/*
+Delete deletes a single file from s3
+*/
+func (svc *Service) Delete(path string) error {
+	_, err := svc.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(svc.config.Bucket),
+		Key:    aws.String(svc.config.key(path)),
+	})
+
+	return err
+}
 
-	for err := range errs {
+/*
+UploadFiles uploads source files to a directory, returning what was stored for each file
+*/
+func (svc *Service) UploadFiles(dir string, files model.ProjectFiles) (map[string]model.ObjectInfo, error) {
+	infos := make(map[string]model.ObjectInfo, len(files))
+	var mu sync.Mutex
+
+	err := forEach(files.Paths(), maxWorkers, func(name string) error {
+		info, err := svc.UploadFile(dir, name, files[name])
 		if err != nil {
 			return err
 		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		infos[name] = info
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return infos, nil
 }
 
 func (svc *Service) GenPresignedURL(path string, exp time.Duration) (string, error) {
-	contentType := mime.TypeByExtension(filepath.Ext(path))
+	contentType := compress.ContentType(path)
 	req, _ := svc.s3.GetObjectRequest(&s3.GetObjectInput{
-		Bucket:              aws.String(env.Get(env.S3_BUCKET)),
-		Key:                 aws.String(path),
+		Bucket:              aws.String(svc.config.Bucket),
+		Key:                 aws.String(svc.config.key(path)),
 		ResponseContentType: aws.String(contentType),
 	})
 
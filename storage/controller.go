@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sammyhass/web-ide/server/compress"
+)
+
+// controller serves downloads for files kept by the local storage backend
+type controller struct {
+	local *Local
+}
+
+func NewController() *controller {
+	return &controller{
+		local: newLocalFromEnv(),
+	}
+}
+
+func (c *controller) Routes(
+	group *gin.RouterGroup,
+) {
+	// signed downloads only need to be served by the API when files are stored locally
+	if Driver() != DriverLocal {
+		return
+	}
+
+	group.GET("/*key", c.download)
+}
+
+func (c *controller) download(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	if err := c.local.Verify(key, ctx.Query("expires"), ctx.Query("signature")); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	f, encoding, err := c.local.open(key)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": "file not found",
+		})
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	if contentType := compress.ContentType(key); contentType != "" {
+		ctx.Header("Content-Type", contentType)
+	}
+
+	// compressed files are sent as they are stored and decompressed by the browser
+	if encoding != "" {
+		ctx.Header("Content-Encoding", encoding)
+	}
+
+	http.ServeContent(ctx.Writer, ctx.Request, path.Base(key), stat.ModTime(), f)
+}
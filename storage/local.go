@@ -0,0 +1,459 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/compress"
+	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+var (
+	errInvalidSignature = errors.New("invalid signature")
+	errExpiredSignature = errors.New("signature has expired")
+)
+
+// Local is a storage backend which keeps files on the local disk, downloads are served by the API itself
+// using HMAC signed URLs in place of presigned s3 URLs
+type Local struct {
+	root    string
+	secret  []byte
+	baseURL string
+}
+
+func NewLocal(root, secret, baseURL string) *Local {
+	return &Local{
+		root:    root,
+		secret:  []byte(secret),
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+func localDir() string {
+	return env.GetOr(env.OPT_STORAGE_LOCAL_DIR, "data")
+}
+
+// PublicURL returns the URL the API can be reached at, used to build links which are downloaded through the API
+func PublicURL() string {
+	return strings.TrimSuffix(
+		env.GetOr(env.OPT_PUBLIC_URL, fmt.Sprintf("http://localhost:%s", env.GetOr(env.PORT, "8080"))),
+		"/",
+	)
+}
+
+func newLocalFromEnv() *Local {
+	return NewLocal(
+		localDir(),
+		env.GetOr(env.OPT_STORAGE_SIGNING_SECRET, env.Get(env.JWT_SECRET)),
+		PublicURL(),
+	)
+}
+
+// encodedDir is the directory under the root holding compressed files, kept apart from the plain files so that the
+// encoding of a file never depends on its name
+const encodedDir = ".gzip"
+
+// filePath converts a storage key to a path on disk, keys can never resolve to a location outside of the root
+func (l *Local) filePath(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// encodedPath converts a storage key to the path on disk of its compressed content
+func (l *Local) encodedPath(key string) string {
+	return filepath.Join(l.root, encodedDir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// open opens the file stored at key, returning the encoding it is stored with
+func (l *Local) open(key string) (*os.File, string, error) {
+	f, err := os.Open(l.encodedPath(key))
+	if err == nil {
+		return f, compress.Gzip, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, "", err
+	}
+
+	f, err = os.Open(l.filePath(key))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return f, "", nil
+}
+
+// writeFile atomically replaces the file at dest with the contents of r, returning the number of bytes written
+func writeFile(dest string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return 0, err
+	}
+
+	// write to a temporary file first so that readers never see a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (l *Local) Upload(
+	dir, fileName string,
+	r io.Reader,
+) (model.ObjectInfo, error) {
+	return l.UploadWithContentType(dir, fileName, compress.ContentType(fileName), r)
+}
+
+/*
+UploadWithContentType stores a file on disk, compressing it if the content type is compressible. The content type is
+not kept as the local backend only serves files through the API, which infers it from the file extension.
+*/
+func (l *Local) UploadWithContentType(
+	dir, fileName, contentType string,
+	r io.Reader,
+) (model.ObjectInfo, error) {
+	return l.upload(path.Join(dir, fileName), contentType, compress.Compressible(contentType), r)
+}
+
+// upload stores a file, removing any copy of it held with a different encoding
+func (l *Local) upload(key, contentType string, compressed bool, r io.Reader) (model.ObjectInfo, error) {
+	info := model.ObjectInfo{ContentType: contentType}
+	dest, stale := l.filePath(key), l.encodedPath(key)
+
+	if compressed {
+		encoded, size, err := compress.Encode(r)
+		if err != nil {
+			return model.ObjectInfo{}, err
+		}
+
+		info.Size = size
+		info.ContentEncoding = compress.Gzip
+		r = bytes.NewReader(encoded)
+		dest, stale = stale, dest
+	}
+
+	n, err := writeFile(dest, r)
+	if err != nil {
+		return model.ObjectInfo{}, err
+	}
+
+	if err := os.Remove(stale); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return model.ObjectInfo{}, err
+	}
+
+	info.StoredSize = n
+	if !compressed {
+		info.Size = n
+	}
+
+	return info, nil
+}
+
+/*
+UploadFiles stores source files in a directory, returning what was stored for each file. Source files are always
+compressed.
+*/
+func (l *Local) UploadFiles(dir string, files model.ProjectFiles) (map[string]model.ObjectInfo, error) {
+	infos := make(map[string]model.ObjectInfo, len(files))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var uploadErr error
+
+	wg.Add(len(files))
+
+	for name, content := range files {
+		go func(name, content string) {
+			defer wg.Done()
+
+			info, err := l.upload(path.Join(dir, name), compress.ContentType(name), true, strings.NewReader(content))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				uploadErr = err
+				return
+			}
+			infos[name] = info
+		}(name, content)
+	}
+
+	wg.Wait()
+
+	if uploadErr != nil {
+		return nil, uploadErr
+	}
+
+	return infos, nil
+}
+
+// walk calls fn with the path relative to root of every file stored beneath root
+func (l *Local) walk(root string, fn func(rel string)) error {
+	encodedRoot := filepath.Join(l.root, encodedDir)
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			// the compressed files are listed through their own root
+			if p != root && p == encodedRoot {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		fn(filepath.ToSlash(rel))
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+/*
+List returns the path of every file in a directory relative to the directory
+*/
+func (l *Local) List(dir string) ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+
+	add := func(rel string) {
+		if !seen[rel] {
+			seen[rel] = true
+			paths = append(paths, rel)
+		}
+	}
+
+	if err := l.walk(l.filePath(dir), add); err != nil {
+		return nil, err
+	}
+
+	if err := l.walk(l.encodedPath(dir), add); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+/*
+GetFiles gets a map of files contained in a directory, keyed by their path relative to the directory
+*/
+func (l *Local) GetFiles(dir string) (map[string]string, error) {
+	paths, err := l.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string, len(paths))
+	for _, p := range paths {
+		r, err := l.Get(path.Join(dir, p))
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		files[p] = string(content)
+	}
+
+	return files, nil
+}
+
+/*
+Get opens a file on disk for reading, compressed files are decompressed while they are read
+*/
+func (l *Local) Get(path string) (io.ReadCloser, error) {
+	f, encoding, err := l.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return compress.DecodeCloser(encoding, f)
+}
+
+/*
+Stat describes a file on disk, the original size of a compressed file is read from its gzip trailer
+*/
+func (l *Local) Stat(path string) (model.ObjectInfo, error) {
+	f, encoding, err := l.open(path)
+	if err != nil {
+		return model.ObjectInfo{}, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return model.ObjectInfo{}, err
+	}
+
+	info := model.ObjectInfo{
+		Size:            stat.Size(),
+		StoredSize:      stat.Size(),
+		ContentType:     compress.ContentType(path),
+		ContentEncoding: encoding,
+		ETag:            fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+		ModTime:         stat.ModTime(),
+	}
+
+	if encoding == compress.Gzip && stat.Size() >= 4 {
+		var trailer [4]byte
+		if _, err := f.ReadAt(trailer[:], stat.Size()-4); err != nil {
+			return model.ObjectInfo{}, err
+		}
+		info.Size = int64(binary.LittleEndian.Uint32(trailer[:]))
+	}
+
+	return info, nil
+}
+
+/*
+GetRange reads part of a file on disk as it is stored
+*/
+func (l *Local) GetRange(path string, offset, length int64) (io.ReadCloser, error) {
+	f, _, err := l.open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+/*
+Copy copies a file on disk, a compressed file stays compressed
+*/
+func (l *Local) Copy(src, dest string) (model.ObjectInfo, error) {
+	f, encoding, err := l.open(src)
+	if err != nil {
+		return model.ObjectInfo{}, err
+	}
+	defer f.Close()
+
+	to, stale := l.filePath(dest), l.encodedPath(dest)
+	if encoding == compress.Gzip {
+		to, stale = stale, to
+	}
+
+	if _, err := writeFile(to, f); err != nil {
+		return model.ObjectInfo{}, err
+	}
+
+	if err := os.Remove(stale); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return model.ObjectInfo{}, err
+	}
+
+	return l.Stat(dest)
+}
+
+/*
+Delete deletes a single file, deleting a file which does not exist is not an error
+*/
+func (l *Local) Delete(path string) error {
+	for _, p := range []string{l.filePath(path), l.encodedPath(path)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+DeleteDir deletes a directory and everything inside of it
+*/
+func (l *Local) DeleteDir(dir string) error {
+	if err := os.RemoveAll(l.filePath(dir)); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(l.encodedPath(dir))
+}
+
+func (l *Local) GenPresignedURL(p string, exp time.Duration) (string, error) {
+	key := strings.TrimPrefix(path.Clean("/"+p), "/")
+	expires := time.Now().Add(exp).Unix()
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", l.sign(key, expires))
+
+	return fmt.Sprintf("%s/storage/%s?%s", l.baseURL, (&url.URL{Path: key}).EscapedPath(), q.Encode()), nil
+}
+
+func (l *Local) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that a signature generated by GenPresignedURL is valid for the given key and has not expired
+func (l *Local) Verify(key, expires, signature string) error {
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+
+	if !hmac.Equal([]byte(l.sign(key, exp)), []byte(signature)) {
+		return errInvalidSignature
+	}
+
+	if time.Now().Unix() > exp {
+		return errExpiredSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/compress"
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestLocal_UploadAndGet(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	if _, err := l.Upload("user/project/src", "main.go", strings.NewReader("package main")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := l.Get("user/project/src/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "package main" {
+		t.Errorf("Expected 'package main', got '%s'", content)
+	}
+}
+
+func TestLocal_GetFiles(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	files := model.ProjectFiles{
+		"main.go":    "package main",
+		"index.html": "<h1>Hello</h1>",
+	}
+
+	if _, err := l.UploadFiles("user/project/src", files); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := l.GetFiles("user/project/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(files) {
+		t.Fatalf("Expected %d files, got %d", len(files), len(got))
+	}
+
+	for name, content := range files {
+		if got[name] != content {
+			t.Errorf("Expected %s to be '%s', got '%s'", name, content, got[name])
+		}
+	}
+}
+
+func TestLocal_GetFilesMissingDir(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	got, err := l.GetFiles("does/not/exist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 0 {
+		t.Errorf("Expected no files, got %d", len(got))
+	}
+}
+
+func TestLocal_List(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	files := model.ProjectFiles{
+		"user/project/src/main.go":    "package main",
+		"user/project/build/out.wasm": "\x00asm",
+	}
+
+	if _, err := l.UploadFiles("", files); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := l.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(got)
+	want := []string{"user/project/build/out.wasm", "user/project/src/main.go"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	got, err = l.List("user/project/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 || got[0] != "main.go" {
+		t.Errorf("Expected paths relative to the directory, got %v", got)
+	}
+}
+
+func TestLocal_DeleteDir(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	if _, err := l.Upload("user/project/src", "main.go", strings.NewReader("package main")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.DeleteDir("user/project"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Get("user/project/src/main.go"); err == nil {
+		t.Error("Expected file to be deleted")
+	}
+}
+
+func TestLocal_Copy(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	wat := strings.Repeat("(module (func $main))\n", 100)
+	if _, err := l.Upload("builds/key", "main.wat", strings.NewReader(wat)); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := l.Copy("builds/key/main.wat", "user/project/build/main.wat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.ContentEncoding != compress.Gzip || info.Size != int64(len(wat)) {
+		t.Errorf("Expected the copy to stay compressed with the original size, got %+v", info)
+	}
+
+	r, err := l.Get("user/project/build/main.wat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if got, _ := io.ReadAll(r); string(got) != wat {
+		t.Error("Expected the copy to have the same content")
+	}
+}
+
+func TestLocal_CompressesText(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	wat := strings.Repeat("(module (func $main))\n", 100)
+
+	info, err := l.Upload("user/project/build", "main.wat", strings.NewReader(wat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.ContentEncoding != "gzip" || info.StoredSize >= info.Size || info.Size != int64(len(wat)) {
+		t.Errorf("Expected main.wat to be stored compressed, got %+v", info)
+	}
+
+	r, err := l.Get("user/project/build/main.wat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != wat {
+		t.Error("Expected the original content to be returned")
+	}
+
+	stat, err := l.Stat("user/project/build/main.wat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stat.Size != info.Size || stat.StoredSize != info.StoredSize || stat.ContentEncoding != "gzip" {
+		t.Errorf("Expected Stat to describe the file as it was uploaded, got %+v", stat)
+	}
+
+	paths, err := l.List("user/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 1 || paths[0] != "build/main.wat" {
+		t.Errorf("Expected compressed files to be listed, got %v", paths)
+	}
+
+	info, err = l.Upload("user/project/build", "sprite.png", strings.NewReader("\x89PNG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.ContentEncoding != "" || info.StoredSize != info.Size {
+		t.Errorf("Expected sprite.png to be stored as it is, got %+v", info)
+	}
+
+	if err := l.DeleteDir("user/project"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Get("user/project/build/main.wat"); err == nil {
+		t.Error("Expected compressed files to be deleted along with their directory")
+	}
+}
+
+func TestLocal_KeysCannotEscapeRoot(t *testing.T) {
+	root := t.TempDir()
+	l := NewLocal(root, "secret", "http://localhost:8080")
+
+	if fp := l.filePath("../../etc/passwd"); !strings.HasPrefix(fp, root) {
+		t.Errorf("Expected %s to be inside %s", fp, root)
+	}
+}
+
+func TestLocal_PresignedURL(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	signed, err := l.GenPresignedURL("user/project/build/main.wasm", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := strings.TrimPrefix(u.Path, "/storage/")
+	if key != "user/project/build/main.wasm" {
+		t.Errorf("Expected key to be in URL path, got %s", u.Path)
+	}
+
+	q := u.Query()
+	if err := l.Verify(key, q.Get("expires"), q.Get("signature")); err != nil {
+		t.Errorf("Expected signature to be valid, got %s", err)
+	}
+
+	if err := l.Verify("user/project/build/main.wat", q.Get("expires"), q.Get("signature")); err == nil {
+		t.Error("Expected signature for a different key to be invalid")
+	}
+
+	if err := NewLocal(t.TempDir(), "other", "").Verify(key, q.Get("expires"), q.Get("signature")); err == nil {
+		t.Error("Expected signature with a different secret to be invalid")
+	}
+}
+
+func TestLocal_ExpiredPresignedURL(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	signed, err := l.GenPresignedURL("main.wasm", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := u.Query()
+	if err := l.Verify("main.wasm", q.Get("expires"), q.Get("signature")); err != errExpiredSignature {
+		t.Errorf("Expected expired signature error, got %v", err)
+	}
+}
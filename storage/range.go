@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var errNegativeOffset = errors.New("seek to a negative offset")
+
+/*
+rangeReader reads a stored file through ranged requests, so a file can be served with http.ServeContent without
+downloading any more of it than the client asked for. Seeking is free, a request is only made on the next read.
+*/
+type rangeReader struct {
+	backend Backend
+	path    string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+/*
+NewRangeReader returns a reader of the file stored at path as it is stored, size must be the stored size of the file
+*/
+func NewRangeReader(backend Backend, path string, size int64) io.ReadSeekCloser {
+	return &rangeReader{
+		backend: backend,
+		path:    path,
+		size:    size,
+	}
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		body, err := r.backend.GetRange(r.path, r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+
+	if err == io.EOF && r.offset < r.size {
+		return n, io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+
+	if offset != r.offset {
+		if err := r.Close(); err != nil {
+			return 0, err
+		}
+		r.offset = offset
+	}
+
+	return r.offset, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRangeReader(t *testing.T) {
+	l := NewLocal(t.TempDir(), "secret", "http://localhost:8080")
+
+	content := "0123456789"
+	if _, err := l.UploadWithContentType("user/project/build", "data", "application/octet-stream", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRangeReader(l, "user/project/build/data", int64(len(content)))
+	defer r.Close()
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil || size != int64(len(content)) {
+		t.Fatalf("Expected seeking to the end to return the size, got %d %v", size, err)
+	}
+
+	if _, err := r.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf) != "456" {
+		t.Errorf("Expected to read 456, got %s", buf)
+	}
+
+	if _, err := r.Seek(-2, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(rest) != "89" {
+		t.Errorf("Expected to read 89, got %s", rest)
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/env"
+	"github.com/sammyhass/web-ide/server/model"
+	"github.com/sammyhass/web-ide/server/s3"
+)
+
+// Backend is implemented by each of the places that project files can be stored
+type Backend interface {
+	// Upload stores the contents of r at dir/fileName, compressing it if its type is compressible
+	Upload(dir, fileName string, r io.Reader) (model.ObjectInfo, error)
+	// UploadWithContentType stores the contents of r at dir/fileName with an explicit content type
+	UploadWithContentType(dir, fileName, contentType string, r io.Reader) (model.ObjectInfo, error)
+	// UploadFiles stores each of the given source files in dir compressed, keyed by their name
+	UploadFiles(dir string, files model.ProjectFiles) (map[string]model.ObjectInfo, error)
+	// List returns the path of every file in dir relative to dir, an empty dir lists everything in storage
+	List(dir string) ([]string, error)
+	// GetFiles gets a map of files contained in a directory, keyed by their path relative to the directory
+	GetFiles(dir string) (map[string]string, error)
+	// Get streams the original content of the file stored at path, the reader must be closed once it has been read
+	Get(path string) (io.ReadCloser, error)
+	// Stat describes the file stored at path
+	Stat(path string) (model.ObjectInfo, error)
+	// GetRange returns length bytes of the file stored at path starting at offset, as it is stored without decompressing
+	GetRange(path string, offset, length int64) (io.ReadCloser, error)
+	// Copy copies the file stored at src to dest as it is stored, without downloading it
+	Copy(src, dest string) (model.ObjectInfo, error)
+	// Delete deletes a single file
+	Delete(path string) error
+	// DeleteDir deletes all the files in a directory
+	DeleteDir(dir string) error
+	// GenPresignedURL generates a URL that can be used to download the file at path until exp has passed
+	GenPresignedURL(path string, exp time.Duration) (string, error)
+}
+
+const (
+	DriverS3    = "s3"
+	DriverLocal = "local"
+)
+
+// checkDir is where Check stores the file it uses to make sure storage can be used
+const checkDir = ".check"
+
+// Driver returns the name of the storage driver selected in the environment, defaulting to s3
+func Driver() string {
+	return env.GetOr(env.OPT_STORAGE_DRIVER, DriverS3)
+}
+
+// Init prepares the selected storage driver, it should be called once before any backends are created
+func Init() {
+	switch Driver() {
+	case DriverS3:
+		s3.InitSession()
+	case DriverLocal:
+		dir := localDir()
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("[storage] Error creating local storage directory: %v", err)
+		}
+		log.Printf("[storage] Using local storage in %s", dir)
+	default:
+		log.Fatalf("[storage] Unknown storage driver %s", Driver())
+	}
+}
+
+/*
+Check makes sure the selected storage driver is configured and can be used, by storing a small file, reading it back
+and deleting it
+*/
+func Check() error {
+	switch Driver() {
+	case DriverS3:
+		if _, err := s3.ConfigFromEnv(); err != nil {
+			return err
+		}
+	case DriverLocal:
+	default:
+		return fmt.Errorf("unknown storage driver %s", Driver())
+	}
+
+	Init()
+	backend := NewBackend()
+
+	name := model.NewID() + ".txt"
+	content := "checking storage can be used"
+
+	if _, err := backend.Upload(checkDir, name, strings.NewReader(content)); err != nil {
+		return fmt.Errorf("error storing a file: %w", err)
+	}
+
+	r, err := backend.Get(path.Join(checkDir, name))
+	if err != nil {
+		return fmt.Errorf("error reading a file: %w", err)
+	}
+
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("error reading a file: %w", err)
+	}
+
+	if string(got) != content {
+		return errors.New("a file read back from storage didn't match what was stored")
+	}
+
+	if err := backend.Delete(path.Join(checkDir, name)); err != nil {
+		return fmt.Errorf("error deleting a file: %w", err)
+	}
+
+	return nil
+}
+
+// IsNotFound reports whether an error returned by a backend was caused by a file not existing
+func IsNotFound(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || s3.IsNotFound(err)
+}
+
+// NewBackend returns the storage backend for the driver selected in the environment
+func NewBackend() Backend {
+	if Driver() == DriverLocal {
+		return newLocalFromEnv()
+	}
+
+	return s3.NewService()
+}
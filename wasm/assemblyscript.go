@@ -1,16 +1,30 @@
 package wasm
 
 import (
-	"bytes"
-	"errors"
+	"context"
 	"os"
-	"os/exec"
 	"path"
+
+	"github.com/sammyhass/web-ide/server/model"
 )
 
 func compileAssemblyScript(assemblyScriptCode string, options CompileOpts) (CompileResult, error) {
+	files := model.ProjectFiles{"main.ts": assemblyScriptCode}
+	return compileAssemblyScriptFiles(context.Background(), onPath("asc"), files, options)
+}
+
+/*
+compileAssemblyScriptFiles compiles the main.ts file of a project, along with anything it imports, to WASM using the
+given version of asc
+*/
+func compileAssemblyScriptFiles(
+	ctx context.Context,
+	compiler installation,
+	files model.ProjectFiles,
+	options CompileOpts,
+) (CompileResult, error) {
 	codeFileName := "main.ts"
-	dir, delete, err := createTempCodeDir(codeFileName, assemblyScriptCode)
+	dir, delete, err := createTempCodeDir(files)
 	if err != nil {
 		return CompileResult{}, err
 	}
@@ -35,19 +49,15 @@ func compileAssemblyScript(assemblyScriptCode string, options CompileOpts) (Comp
 	}
 
 	command = append(command, "--importMemory")
+	command = append(command, ascFlags(options.Settings)...)
 
-	stderr := bytes.NewBuffer(nil)
-	stdout := bytes.NewBuffer(nil)
-
-	cmd := exec.Command("asc", command...)
-	cmd.Stderr = stderr
-	cmd.Stdout = stdout
-	cmd.Dir = dir
+	parse := func(output string) []model.Diagnostic {
+		return parseAssemblyScriptDiagnostics(output, dir)
+	}
 
-	if err := cmd.Run(); err != nil {
-		if stderr.Len() > 0 {
-			return CompileResult{}, errors.New(stderr.String())
-		}
+	stderr, err := runCompilerWithEnv(ctx, dir, options.Output, compiler.env(), compiler.binary, command...)
+	if err != nil {
+		return CompileResult{}, compilerError(err, stderr, parse)
 	}
 
 	wasmBytes, err := os.ReadFile(wasmF.Name())
@@ -68,13 +78,15 @@ func compileAssemblyScript(assemblyScriptCode string, options CompileOpts) (Comp
 		}
 
 		return CompileResult{
-			Wasm: wasmBytes,
-			Wat:  string(watBytes),
+			Wasm:        wasmBytes,
+			Wat:         string(watBytes),
+			Diagnostics: parse(stderr),
 		}, nil
 	}
 
 	return CompileResult{
-		Wasm: wasmBytes,
+		Wasm:        wasmBytes,
+		Diagnostics: parse(stderr),
 	}, nil
 
 }
@@ -1,8 +1,11 @@
 package wasm
 
 import (
+	"context"
 	"strings"
 	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
 )
 
 func TestCompile_ValidAssemblyScript(t *testing.T) {
@@ -62,3 +65,23 @@ func TestCompile_InvalidAssemblyScript(t *testing.T) {
 	}
 
 }
+
+func TestCompile_AssemblyScriptImports(t *testing.T) {
+	res, err := compileAssemblyScriptFiles(context.Background(), onPath("asc"), model.ProjectFiles{
+		"main.ts": `import { add } from "./lib/math";
+
+export function double(a: i32): i32 {
+	return add(a, a);
+}`,
+		"lib/math.ts": `export function add(a: i32, b: i32): i32 {
+	return a + b;
+}`,
+	}, CompileOpts{GenWat: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(res.Wat, "double") {
+		t.Error("Expected wat to contain 'double'")
+	}
+}
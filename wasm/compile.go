@@ -1,9 +1,10 @@
 package wasm
 
 import (
+	"context"
 	"errors"
 	"os"
-	"path"
+	"path/filepath"
 
 	"github.com/sammyhass/web-ide/server/model"
 )
@@ -11,25 +12,83 @@ import (
 type CompileOpts struct {
 	GenWat       bool                      // whether or not to generate a wat file along with the wasm file
 	BeforeDelete func(wasm *os.File) error // BeforeDelete is called before the temp directory is deleted, it is passed the compiled WASM file
+	User         string                    // User is who the compile is for, compiler processes are shared fairly between users
+	Output       OutputFunc                // Output is passed each line written by the compilers while the project is built
+	Settings     model.BuildSettings       // Settings are the project's build settings, which are turned into compiler flags
+	Version      string                    // Version is the version of the compiler a project is pinned to, empty for the default
 }
 
+/*
+OutputFunc is passed each line a compiler writes to stream, either model.StreamStdout or model.StreamStderr. The lines of
+each stream are passed in order, but lines of stdout and stderr can be passed at the same time from different goroutines.
+*/
+type OutputFunc func(stream, line string)
+
 type CompileResult struct {
-	Wasm []byte
-	Wat  string
+	Wasm  []byte
+	Wat   string
+	Queue QueueStats // Queue describes how long the compile waited for a compiler process
+	// Diagnostics are the warnings reported by the compiler for a project which compiled
+	Diagnostics []model.Diagnostic
+	// Toolchain is the compiler and the exact version of it the project was compiled with, such as tinygo 0.26.0
+	Toolchain string
 }
 
-func Compile(language model.ProjectLanguage, code string, options CompileOpts) (CompileResult, error) {
+/*
+Compile builds the entry file of a project to WASM with the project's whole source tree laid out on disk. It waits its
+turn for a compiler process and then runs the compiler in a sandbox within the limits set by SetLimits.
+*/
+func Compile(
+	ctx context.Context,
+	language model.ProjectLanguage,
+	files model.ProjectFiles,
+	options CompileOpts,
+) (CompileResult, error) {
+	var compile func(context.Context, installation, model.ProjectFiles, CompileOpts) (CompileResult, error)
+
 	switch language {
 	case model.LanguageAssemblyScript:
-		return compileAssemblyScript(code, options)
+		compile = compileAssemblyScriptFiles
 	case model.LanguageGo:
-		return compileTinyGo(code, options)
+		compile = compileTinyGoFiles
 	default:
 		return CompileResult{}, errors.New("unknown language")
 	}
+
+	compiler, err := checkToolchain(language, options.Version)
+	if err != nil {
+		return CompileResult{}, err
+	}
+
+	if err := ValidateSettings(language, compiler.version, options.Settings); err != nil {
+		return CompileResult{}, err
+	}
+
+	release, stats, err := scheduler.Acquire(ctx, options.User)
+	if err != nil {
+		return CompileResult{Queue: stats}, err
+	}
+	defer release()
+
+	// time spent waiting for a compiler process doesn't count towards the time limit
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	res, err := compile(ctx, compiler, files, options)
+	res.Queue = stats
+	res.Toolchain = compiler.String()
+
+	return res, err
 }
 
-func createTempCodeDir(fname string, code string) (string, func(), error) {
+/*
+createTempCodeDir creates a temporary directory containing each of the given files, creating any directories needed
+to preserve the layout of the project source tree
+*/
+func createTempCodeDir(files model.ProjectFiles) (string, func(), error) {
 	tmpDir, err := os.MkdirTemp("", "project-dir-*")
 	if err != nil {
 		return "", nil, err
@@ -39,19 +98,23 @@ func createTempCodeDir(fname string, code string) (string, func(), error) {
 		os.RemoveAll(tmpDir)
 	}
 
-	createInTemp := func(filename string) (*os.File, error) {
-		return os.Create(path.Join(tmpDir, filename))
-	}
+	for name, content := range files {
+		p, err := model.CleanFilePath(name)
+		if err != nil {
+			deleteDir()
+			return "", nil, err
+		}
 
-	codeFile, err := createInTemp(fname)
-	if err != nil {
-		deleteDir()
-		return "", nil, err
-	}
+		dest := filepath.Join(tmpDir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			deleteDir()
+			return "", nil, err
+		}
 
-	if _, err := codeFile.Write([]byte(code)); err != nil {
-		deleteDir()
-		return "", nil, err
+		if err := os.WriteFile(dest, []byte(content), 0o644); err != nil {
+			deleteDir()
+			return "", nil, err
+		}
 	}
 
 	return tmpDir, deleteDir, nil
@@ -0,0 +1,45 @@
+package wasm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestCreateTempCodeDir_LaysOutTree(t *testing.T) {
+	files := model.ProjectFiles{
+		"main.go":          "package main",
+		"lib/math.go":      "package lib",
+		"lib/util/util.go": "package util",
+	}
+
+	dir, deleteDir, err := createTempCodeDir(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deleteDir()
+
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Expected %s to exist, got %s", name, err)
+			continue
+		}
+
+		if string(got) != content {
+			t.Errorf("Expected %s to contain '%s', got '%s'", name, content, got)
+		}
+	}
+}
+
+func TestCreateTempCodeDir_RejectsEscapingPaths(t *testing.T) {
+	_, _, err := createTempCodeDir(model.ProjectFiles{
+		"../escape.go": "package main",
+	})
+
+	if err == nil {
+		t.Error("Expected an error for a path outside of the project")
+	}
+}
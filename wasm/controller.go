@@ -0,0 +1,23 @@
+package wasm
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// controller reports which languages can be compiled
+type controller struct{}
+
+func NewController() *controller {
+	return &controller{}
+}
+
+func (c *controller) Routes(
+	group *gin.RouterGroup,
+) {
+	group.GET("", c.getToolchains)
+}
+
+// getToolchains lists each language with whether it can be compiled and the versions of the tools it is compiled with
+func (c *controller) getToolchains(ctx *gin.Context) {
+	ctx.JSON(200, Toolchains())
+}
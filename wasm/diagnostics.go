@@ -0,0 +1,136 @@
+package wasm
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+/*
+CompileError is returned when the source of a project fails to compile. Output is everything the compiler reported and
+Diagnostics holds each of the problems found in it.
+*/
+type CompileError struct {
+	Output      string
+	Diagnostics []model.Diagnostic
+}
+
+func (e *CompileError) Error() string {
+	return e.Output
+}
+
+/*
+newCompileError describes the output of a compiler which failed. Output which can't be parsed is kept as a single
+diagnostic without a location so that every failure has at least one.
+*/
+func newCompileError(output string, diagnostics []model.Diagnostic) *CompileError {
+	output = strings.TrimSpace(output)
+
+	if len(diagnostics) == 0 {
+		diagnostics = []model.Diagnostic{{Severity: model.SeverityError, Message: output}}
+	}
+
+	return &CompileError{Output: output, Diagnostics: diagnostics}
+}
+
+// compilerError describes why a compiler failed, parsing its output into diagnostics when it failed to compile the project
+func compilerError(err error, stderr string, parse func(string) []model.Diagnostic) error {
+	if err != errCompilerFailed {
+		return err
+	}
+
+	return newCompileError(stderr, parse(stderr))
+}
+
+// projectPath returns the path of a file reported by a compiler relative to the project directory dir
+func projectPath(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil && filepath.IsAbs(file) && !strings.HasPrefix(rel, "..") {
+		file = rel
+	}
+
+	return strings.TrimPrefix(filepath.ToSlash(file), "./")
+}
+
+// goDiagnostic matches the errors reported by the Go toolchain, such as main.go:5:2: undefined: x
+var goDiagnostic = regexp.MustCompile(`^(\S+\.go):(\d+)(?::(\d+))?:\s*(.+)$`)
+
+/*
+parseGoDiagnostics parses the errors written by tinygo when building the project in dir. Lines which continue the
+message of the error before them are indented.
+*/
+func parseGoDiagnostics(output, dir string) []model.Diagnostic {
+	var diagnostics []model.Diagnostic
+
+	for _, line := range strings.Split(output, "\n") {
+		m := goDiagnostic.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			if n := len(diagnostics); n > 0 && strings.HasPrefix(line, "\t") {
+				diagnostics[n-1].Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		d := model.Diagnostic{
+			File:     projectPath(dir, m[1]),
+			Severity: model.SeverityError,
+			Message:  m[4],
+		}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+
+		diagnostics = append(diagnostics, d)
+	}
+
+	return diagnostics
+}
+
+var (
+	// ascHeader matches the first line of a problem reported by asc, such as ERROR TS2322: Type ... is not assignable
+	ascHeader = regexp.MustCompile(`^(ERROR|WARNING|INFO|PEDANTIC)\s+([A-Z]+\d+):\s*(.*)$`)
+	// ascLocation matches where a problem reported by asc was found, such as in main.ts(7,11)
+	ascLocation = regexp.MustCompile(`\bin (\S+?)\((\d+),(\d+)\)`)
+)
+
+var ascSeverities = map[string]string{
+	"ERROR":    model.SeverityError,
+	"WARNING":  model.SeverityWarning,
+	"INFO":     model.SeverityInfo,
+	"PEDANTIC": model.SeverityInfo,
+}
+
+/*
+parseAssemblyScriptDiagnostics parses the problems written by asc when compiling the project in dir. Each problem is a
+header line followed by the offending source and the file it was found in.
+*/
+func parseAssemblyScriptDiagnostics(output, dir string) []model.Diagnostic {
+	var diagnostics []model.Diagnostic
+	located := true
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if m := ascHeader.FindStringSubmatch(line); m != nil {
+			diagnostics = append(diagnostics, model.Diagnostic{
+				Severity: ascSeverities[m[1]],
+				Code:     m[2],
+				Message:  m[3],
+			})
+			located = false
+			continue
+		}
+
+		// only the first location is used, later ones point to related declarations
+		if m := ascLocation.FindStringSubmatch(line); m != nil && !located {
+			d := &diagnostics[len(diagnostics)-1]
+			d.File = projectPath(dir, m[1])
+			d.Line, _ = strconv.Atoi(m[2])
+			d.Column, _ = strconv.Atoi(m[3])
+			located = true
+		}
+	}
+
+	return diagnostics
+}
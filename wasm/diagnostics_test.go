@@ -0,0 +1,95 @@
+package wasm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestParseGoDiagnostics(t *testing.T) {
+	output := `# project
+/tmp/code123/main.go:5:2: undefined: x
+lib/util.go:12:9: cannot use s (variable of type string) as int value in return statement
+	have (string)
+	want (int)
+main.go:3: syntax error: unexpected newline
+`
+
+	want := []model.Diagnostic{
+		{File: "main.go", Line: 5, Column: 2, Severity: model.SeverityError, Message: "undefined: x"},
+		{
+			File:     "lib/util.go",
+			Line:     12,
+			Column:   9,
+			Severity: model.SeverityError,
+			Message:  "cannot use s (variable of type string) as int value in return statement\nhave (string)\nwant (int)",
+		},
+		{File: "main.go", Line: 3, Severity: model.SeverityError, Message: "syntax error: unexpected newline"},
+	}
+
+	got := parseGoDiagnostics(output, "/tmp/code123")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestParseAssemblyScriptDiagnostics(t *testing.T) {
+	output := `ERROR TS2322: Type '~lib/string/String' is not assignable to type 'i32'.
+    :
+  6 │ return "hello";
+    │        ~~~~~~~
+    └─ in main.ts(6,10)
+
+WARNING AS233: Function 'helper' is never used.
+   in lib/math.ts(2,17)
+   in main.ts(1,1)
+
+FAILURE 1 compile error(s)
+`
+
+	want := []model.Diagnostic{
+		{
+			File:     "main.ts",
+			Line:     6,
+			Column:   10,
+			Severity: model.SeverityError,
+			Message:  "Type '~lib/string/String' is not assignable to type 'i32'.",
+			Code:     "TS2322",
+		},
+		{
+			File:     "lib/math.ts",
+			Line:     2,
+			Column:   17,
+			Severity: model.SeverityWarning,
+			Message:  "Function 'helper' is never used.",
+			Code:     "AS233",
+		},
+	}
+
+	got := parseAssemblyScriptDiagnostics(output, "/tmp/code123")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCompilerError(t *testing.T) {
+	err := compilerError(errCompilerFailed, "panic: something went wrong\n", func(string) []model.Diagnostic {
+		return nil
+	})
+
+	compileErr, ok := err.(*CompileError)
+	if !ok {
+		t.Fatalf("Expected a CompileError, got %v", err)
+	}
+
+	want := []model.Diagnostic{{Severity: model.SeverityError, Message: "panic: something went wrong"}}
+	if !reflect.DeepEqual(compileErr.Diagnostics, want) {
+		t.Errorf("Expected output which can't be parsed to be one diagnostic, got %+v", compileErr.Diagnostics)
+	}
+
+	limitErr := newLimitError("timeout", "too slow")
+	if err := compilerError(limitErr, "", nil); err != limitErr {
+		t.Errorf("Expected errors other than a failed compile to be returned as they are, got %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+// Limits bound what a compile can use, a limit of 0 is not enforced
+type Limits struct {
+	Timeout  time.Duration // Timeout is the longest a compile can take once it has a compiler process
+	CPUTime  time.Duration // CPUTime is the most CPU time each compiler process can use
+	Memory   int64         // Memory is the most memory in bytes each compiler process can allocate
+	FileSize int64         // FileSize is the largest file in bytes a compiler process can write
+	Output   int64         // Output is the most a compiler process can write to each of stdout and stderr
+}
+
+var DefaultLimits = Limits{
+	Timeout:  2 * time.Minute,
+	CPUTime:  2 * time.Minute,
+	Memory:   1 << 30,
+	FileSize: 64 << 20,
+	Output:   1 << 20,
+}
+
+var limits = DefaultLimits
+
+/*
+SetLimits sets the limits applied to every compile, it should be called before anything is compiled
+*/
+func SetLimits(l Limits) {
+	limits = l
+}
+
+// sandboxRequired is whether compilers are refused, rather than run without isolation, when they can't be isolated
+var sandboxRequired bool
+
+/*
+SetSandboxRequired sets whether compilers are refused when they can't be isolated from the network and the rest of the
+host's processes, it should be called before anything is compiled
+*/
+func SetSandboxRequired(required bool) {
+	sandboxRequired = required
+}
+
+// errNotIsolated is returned when a compiler would run without isolation while the sandbox is required
+var errNotIsolated = errors.New("compilers can't be isolated on this host and the sandbox is required")
+
+// errCompilerFailed is returned when a compiler exits with an error, the reason is in what it wrote to stderr
+var errCompilerFailed = errors.New("compiler failed")
+
+// LimitError is returned when a compile is stopped for going over one of its limits
+type LimitError struct {
+	Limit string // Limit is the name of the limit which was exceeded
+	msg   string
+}
+
+func (e *LimitError) Error() string {
+	return e.msg
+}
+
+func newLimitError(limit, format string, args ...interface{}) *LimitError {
+	return &LimitError{Limit: limit, msg: fmt.Sprintf(format, args...)}
+}
+
+// cappedBuffer holds at most max bytes of output, calling exceeded the first time more than max bytes are written
+type cappedBuffer struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	max      int64
+	over     bool
+	exceeded func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.max > 0 && int64(b.buf.Len()+len(p)) > b.max {
+		b.buf.Write(p[:b.max-int64(b.buf.Len())])
+		if !b.over {
+			b.over = true
+			b.exceeded()
+		}
+
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// lineWriter calls line with each line written to it, without the line ending
+type lineWriter struct {
+	buf  []byte
+	line func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.line(strings.TrimSuffix(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// flush passes on the last line written if it didn't end with a newline
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+}
+
+// writer returns a writer passing each line written to a stream of a compiler to output, nil if output is nil
+func (output OutputFunc) writer(stream string) *lineWriter {
+	if output == nil {
+		return nil
+	}
+
+	return &lineWriter{line: func(line string) {
+		output(stream, line)
+	}}
+}
+
+/*
+rlimitScript returns the shell commands which apply the resource limits to the compiler before it is started. Limits
+which can't be set because a lower hard limit is already in place are left as they are.
+*/
+func rlimitScript(l Limits) string {
+	var script strings.Builder
+
+	if l.CPUTime > 0 {
+		fmt.Fprintf(&script, "ulimit -t %d 2>/dev/null; ", int64((l.CPUTime+time.Second-1)/time.Second))
+	}
+
+	if l.Memory > 0 {
+		// the data segment limit covers the heaps of both TinyGo and node without counting address space reserved by
+		// their runtimes, ulimit counts it in kilobytes
+		fmt.Fprintf(&script, "ulimit -d %d 2>/dev/null; ", (l.Memory+1023)/1024)
+	}
+
+	if l.FileSize > 0 {
+		// sh counts file sizes in blocks of 512 bytes
+		fmt.Fprintf(&script, "ulimit -f %d 2>/dev/null; ", (l.FileSize+511)/512)
+	}
+
+	script.WriteString(`exec "$0" "$@"`)
+	return script.String()
+}
+
+// sandboxEnv is the environment compilers run with, dir is their scratch directory
+func sandboxEnv(dir string) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		// modules can't be downloaded without a network so don't try
+		"GOPROXY=off",
+	}
+
+	// the toolchains keep their caches outside of the scratch directory so that each compile doesn't rebuild them
+	if cache, err := os.UserCacheDir(); err == nil {
+		env = append(env, "XDG_CACHE_HOME="+cache)
+	}
+
+	for _, key := range []string{"GOROOT", "GOCACHE", "TINYGOROOT", "LANG"} {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+
+	return env
+}
+
+// setEnv sets each of vars, given as KEY=value, in env, replacing any value env already has for the same key
+func setEnv(env []string, vars ...string) []string {
+	set := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		key, _, _ := strings.Cut(v, "=")
+		set[key] = true
+	}
+
+	out := make([]string, 0, len(env)+len(vars))
+	for _, v := range env {
+		if key, _, _ := strings.Cut(v, "="); !set[key] {
+			out = append(out, v)
+		}
+	}
+
+	return append(out, vars...)
+}
+
+// reports reports whether the output of a compiler contains any of the given messages
+func reports(stderr string, msgs ...string) bool {
+	for _, msg := range msgs {
+		if strings.Contains(stderr, msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+runCompiler runs a compiler in dir within the limits, returning what it wrote to stderr. The compiler has dir as its
+home and temporary directory, and on Linux it is isolated from the network and the rest of the host's processes where
+namespaces are available. Nothing is run when compilers can't be isolated and the sandbox is required. A compiler
+which goes over a limit is killed along with anything it started and a LimitError is returned, otherwise
+errCompilerFailed is returned if the compiler exits with an error. Each line the compiler writes is passed to output as
+it is written, unless output is nil.
+*/
+func runCompiler(ctx context.Context, dir string, output OutputFunc, name string, args ...string) (string, error) {
+	return runCompilerWithEnv(ctx, dir, output, nil, name, args...)
+}
+
+// runCompilerWithEnv runs a compiler in the same way as runCompiler, with env set in its environment as well
+func runCompilerWithEnv(
+	ctx context.Context,
+	dir string,
+	output OutputFunc,
+	env []string,
+	name string,
+	args ...string,
+) (string, error) {
+	if sandboxRequired && !Isolated() {
+		return "", errNotIsolated
+	}
+
+	l := limits
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stdout := &cappedBuffer{max: l.Output, exceeded: cancel}
+	stderr := &cappedBuffer{max: l.Output, exceeded: cancel}
+
+	cmd := exec.Command("/bin/sh", append([]string{"-c", rlimitScript(l), name}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = setEnv(sandboxEnv(dir), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	isolate(cmd)
+
+	stdoutLines, stderrLines := output.writer(model.StreamStdout), output.writer(model.StreamStderr)
+	if output != nil {
+		cmd.Stdout = io.MultiWriter(stdout, stdoutLines)
+		cmd.Stderr = io.MultiWriter(stderr, stderrLines)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			kill(cmd)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+
+	if output != nil {
+		stdoutLines.flush()
+		stderrLines.flush()
+	}
+
+	if err == nil {
+		return stderr.String(), nil
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return stderr.String(), newLimitError("timeout", "compile took longer than the time limit of %s", l.Timeout)
+	case stdout.over || stderr.over:
+		return stderr.String(), newLimitError("output", "compiler wrote more than the output limit of %d bytes", l.Output)
+	case signalled(err, sigCPU):
+		return stderr.String(), newLimitError("cpu", "compile used more than the CPU time limit of %s", l.CPUTime)
+	// the server ignores SIGXFSZ, which compilers inherit, so writes past the limit usually fail instead
+	case signalled(err, sigFileSize) || (l.FileSize > 0 && reports(stderr.String(), "File too large", "file too large")):
+		return stderr.String(), newLimitError("file size", "compiler wrote a file larger than the limit of %d bytes", l.FileSize)
+	case l.Memory > 0 && reports(stderr.String(), "out of memory", "Cannot allocate memory", "std::bad_alloc"):
+		return stderr.String(), newLimitError("memory", "compile used more than the memory limit of %d bytes", l.Memory)
+	case ctx.Err() != nil:
+		return stderr.String(), ctx.Err()
+	}
+
+	// sh exits with 127 when the compiler isn't installed
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 127 {
+		return stderr.String(), fmt.Errorf("%s could not be run: %s", name, strings.TrimSpace(stderr.String()))
+	}
+
+	if strings.TrimSpace(stderr.String()) == "" {
+		return "", fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	return stderr.String(), errCompilerFailed
+}
@@ -0,0 +1,97 @@
+//go:build linux
+
+package wasm
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+const (
+	sigCPU      = syscall.SIGXCPU
+	sigFileSize = syscall.SIGXFSZ
+)
+
+/*
+namespaceFlags give each compiler its own user, network, process, IPC and hostname namespaces. The new network namespace
+has no interfaces other than a loopback device which is down, so compilers can't reach the network.
+*/
+const namespaceFlags = syscall.CLONE_NEWUSER |
+	syscall.CLONE_NEWNET |
+	syscall.CLONE_NEWPID |
+	syscall.CLONE_NEWIPC |
+	syscall.CLONE_NEWUTS
+
+var (
+	namespacesOnce      sync.Once
+	namespacesAvailable bool
+)
+
+// namespaceAttr runs a process in new namespaces as the same user it would otherwise run as
+func namespaceAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setpgid:    true,
+		Cloneflags: namespaceFlags,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1},
+		},
+	}
+}
+
+/*
+canUseNamespaces reports whether processes can be started in new namespaces, which needs unprivileged user namespaces to
+be enabled. The first call checks by starting a process and the result is kept for later calls.
+*/
+func canUseNamespaces() bool {
+	namespacesOnce.Do(func() {
+		cmd := exec.Command("/bin/sh", "-c", "exit 0")
+		cmd.SysProcAttr = namespaceAttr()
+
+		if err := cmd.Run(); err != nil {
+			log.Printf("[wasm] Namespaces are unavailable, compilers will run without isolation: %v", err)
+			return
+		}
+
+		namespacesAvailable = true
+	})
+
+	return namespacesAvailable
+}
+
+// Isolated reports whether compilers run isolated from the network and the rest of the host's processes
+func Isolated() bool {
+	return canUseNamespaces()
+}
+
+// isolate runs a compiler in its own process group, within new namespaces where they are available
+func isolate(cmd *exec.Cmd) {
+	if canUseNamespaces() {
+		cmd.SysProcAttr = namespaceAttr()
+		return
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// kill stops a compiler along with every process it started
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// signalled reports whether a process was killed by sig
+func signalled(err error, sig syscall.Signal) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == sig
+}
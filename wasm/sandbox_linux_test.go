@@ -0,0 +1,39 @@
+//go:build linux
+
+package wasm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunCompiler_FileSizeLimit(t *testing.T) {
+	l := DefaultLimits
+	l.FileSize = 4096
+	withLimits(t, l)
+
+	_, err := runCompiler(context.Background(), t.TempDir(), nil, "dd", "if=/dev/zero", "of=big", "bs=8192", "count=1")
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "file size" {
+		t.Fatalf("Expected the file size limit to be exceeded, got %v", err)
+	}
+}
+
+func TestRunCompiler_NoNetwork(t *testing.T) {
+	if !canUseNamespaces() {
+		t.Skip("namespaces are unavailable")
+	}
+
+	// only the loopback device exists in a new network namespace
+	stderr, err := runCompiler(context.Background(), t.TempDir(), nil, "sh", "-c", "tail -n +3 /proc/net/dev >&2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(strings.SplitN(stderr, ":", 2)[0]) != "lo" || strings.Count(stderr, ":") != 1 {
+		t.Errorf("Expected only a loopback device, got '%s'", stderr)
+	}
+}
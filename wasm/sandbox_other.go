@@ -0,0 +1,31 @@
+//go:build !linux
+
+package wasm
+
+import (
+	"os/exec"
+)
+
+// resource limit signals are only told apart on Linux
+const (
+	sigCPU      = 0
+	sigFileSize = 0
+)
+
+// Isolated reports whether compilers run isolated from the rest of the host, which is never the case outside of Linux
+func Isolated() bool {
+	return false
+}
+
+// isolate does nothing outside of Linux, compilers run with the same access as the server
+func isolate(cmd *exec.Cmd) {}
+
+// kill stops a compiler
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// signalled reports whether a process was killed by sig, which can only be told on Linux
+func signalled(err error, sig int) bool {
+	return false
+}
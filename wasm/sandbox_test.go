@@ -0,0 +1,158 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+// withLimits applies l for the rest of a test
+func withLimits(t *testing.T, l Limits) {
+	t.Helper()
+
+	prev := limits
+	SetLimits(l)
+	t.Cleanup(func() { SetLimits(prev) })
+}
+
+func TestRunCompiler_ReturnsStderr(t *testing.T) {
+	stderr, err := runCompiler(context.Background(), t.TempDir(), nil, "sh", "-c", "echo warning >&2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(stderr) != "warning" {
+		t.Errorf("Expected 'warning', got '%s'", stderr)
+	}
+}
+
+func TestRunCompiler_FailureUsesStderr(t *testing.T) {
+	stderr, err := runCompiler(context.Background(), t.TempDir(), nil, "sh", "-c", "echo main.go:1: syntax error >&2; exit 1")
+	if err != errCompilerFailed || !strings.Contains(stderr, "syntax error") {
+		t.Errorf("Expected the compiler's error output, got %v: %s", err, stderr)
+	}
+
+	_, err = runCompiler(context.Background(), t.TempDir(), nil, "not-a-compiler")
+	if err == nil || err == errCompilerFailed {
+		t.Errorf("Expected an error for a compiler which isn't installed, got %v", err)
+	}
+}
+
+func TestRunCompiler_StreamsOutput(t *testing.T) {
+	var mu sync.Mutex
+	lines := map[string][]string{}
+
+	output := func(stream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines[stream] = append(lines[stream], line)
+	}
+
+	_, err := runCompiler(context.Background(), t.TempDir(), output, "sh", "-c", "echo one; echo two; printf oops >&2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(lines[model.StreamStdout], ","); got != "one,two" {
+		t.Errorf("Expected stdout lines 'one,two', got '%s'", got)
+	}
+
+	if got := strings.Join(lines[model.StreamStderr], ","); got != "oops" {
+		t.Errorf("Expected the unterminated stderr line 'oops', got '%s'", got)
+	}
+}
+
+func TestRunCompiler_UsesScratchDir(t *testing.T) {
+	dir := t.TempDir()
+
+	stderr, err := runCompiler(context.Background(), dir, nil, "sh", "-c", `echo "$HOME $TMPDIR" >&2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(stderr) != dir+" "+dir {
+		t.Errorf("Expected the scratch dir to be the home and temporary directory, got '%s'", stderr)
+	}
+}
+
+func TestRunCompilerWithEnv_OverridesEnv(t *testing.T) {
+	dir := t.TempDir()
+
+	env := []string{"HOME=/elsewhere", "EXTRA=1"}
+
+	stderr, err := runCompilerWithEnv(context.Background(), dir, nil, env, "sh", "-c", `echo "$HOME $EXTRA" >&2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.TrimSpace(stderr); got != "/elsewhere 1" {
+		t.Errorf("Expected the variables to be set in the compiler's environment, got '%s'", got)
+	}
+}
+
+func TestRunCompiler_Timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := runCompiler(ctx, t.TempDir(), nil, "sleep", "5")
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "timeout" {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	if time.Since(start) > 2*time.Second {
+		t.Error("Expected the compiler to be killed when the time limit passed")
+	}
+}
+
+func TestRunCompiler_OutputLimit(t *testing.T) {
+	l := DefaultLimits
+	l.Output = 1024
+	withLimits(t, l)
+
+	_, err := runCompiler(context.Background(), t.TempDir(), nil, "yes")
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "output" {
+		t.Fatalf("Expected the output limit to be exceeded, got %v", err)
+	}
+}
+
+func TestRlimitScript(t *testing.T) {
+	script := rlimitScript(Limits{CPUTime: 1500 * time.Millisecond, Memory: 2048, FileSize: 1000})
+
+	for _, want := range []string{"ulimit -t 2 ", "ulimit -d 2 ", "ulimit -f 2 ", `exec "$0" "$@"`} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected the script to contain '%s', got '%s'", want, script)
+		}
+	}
+
+	if script := rlimitScript(Limits{}); script != `exec "$0" "$@"` {
+		t.Errorf("Expected no limits to be set, got '%s'", script)
+	}
+}
+
+func TestRunCompiler_SandboxRequired(t *testing.T) {
+	if Isolated() {
+		t.Skip("compilers are isolated on this host")
+	}
+
+	SetSandboxRequired(true)
+	t.Cleanup(func() { SetSandboxRequired(false) })
+
+	if _, err := runCompiler(context.Background(), t.TempDir(), nil, "sh", "-c", "exit 0"); err != errNotIsolated {
+		t.Errorf("Expected compilers to be refused without isolation, got %v", err)
+	}
+
+	var unavailable *UnavailableError
+	if err := CheckToolchain(model.LanguageGo, ""); !errors.As(err, &unavailable) {
+		t.Errorf("Expected the toolchain to be unavailable without isolation, got %v", err)
+	}
+}
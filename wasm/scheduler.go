@@ -0,0 +1,223 @@
+package wasm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultConcurrency is the number of compiler processes allowed to run at once unless set with SetConcurrency
+const DefaultConcurrency = 2
+
+// QueueStats describes how long a compile waited for a compiler process to become free
+type QueueStats struct {
+	Depth int           // Depth is the number of compiles which were already waiting when the compile was queued
+	Wait  time.Duration // Wait is how long the compile waited before it started
+}
+
+// waiter is a compile waiting for its turn to run
+type waiter struct {
+	user   string
+	queued time.Time
+	ready  chan struct{}
+}
+
+/*
+Scheduler limits how many compiler processes run at once. Compiles beyond the limit are queued, and when a process
+finishes the next compile to run is taken from the user with the fewest compiles running, taking turns between users
+with the same number running, so that one user queueing many compiles can't starve everyone else. Each user's compiles
+run in the order they were queued.
+*/
+type Scheduler struct {
+	mu       sync.Mutex
+	capacity int
+	running  map[string]int       // running counts the compiles running for each user
+	queues   map[string][]*waiter // queues holds the compiles waiting for each user, oldest first
+	turns    map[string]uint64    // turns holds when each user with compiles running or waiting last started one
+	turn     uint64
+	waiting  int
+	total    int
+}
+
+func NewScheduler(capacity int) *Scheduler {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &Scheduler{
+		capacity: capacity,
+		running:  make(map[string]int),
+		queues:   make(map[string][]*waiter),
+		turns:    make(map[string]uint64),
+	}
+}
+
+/*
+Acquire waits until user can start a compiler process, returning a function which must be called once the process has
+finished along with how long the compile was queued. A compile which is still waiting when ctx is done is taken out of
+the queue and ctx's error is returned.
+*/
+func (s *Scheduler) Acquire(ctx context.Context, user string) (release func(), stats QueueStats, err error) {
+	s.mu.Lock()
+
+	if s.total < s.capacity && s.waiting == 0 {
+		s.start(user)
+		s.mu.Unlock()
+		return s.releaser(user), stats, nil
+	}
+
+	w := &waiter{user: user, queued: time.Now(), ready: make(chan struct{})}
+	stats.Depth = s.waiting
+	s.queues[user] = append(s.queues[user], w)
+	s.waiting++
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		stats.Wait = time.Since(w.queued)
+		return s.releaser(user), stats, nil
+	case <-ctx.Done():
+	}
+
+	stats.Wait = time.Since(w.queued)
+
+	s.mu.Lock()
+	removed := s.remove(w)
+	s.mu.Unlock()
+
+	if !removed {
+		// the compile was started just as ctx was done, the process it was given goes to the next compile
+		s.releaser(user)()
+	}
+
+	return nil, stats, ctx.Err()
+}
+
+// remove takes a waiting compile out of the queue, reporting false if it has already started. s.mu must be held.
+func (s *Scheduler) remove(w *waiter) bool {
+	queue := s.queues[w.user]
+	for i, q := range queue {
+		if q != w {
+			continue
+		}
+
+		if len(queue) == 1 {
+			delete(s.queues, w.user)
+
+			if s.running[w.user] == 0 {
+				delete(s.turns, w.user)
+			}
+		} else {
+			s.queues[w.user] = append(queue[:i:i], queue[i+1:]...)
+		}
+		s.waiting--
+
+		return true
+	}
+
+	return false
+}
+
+// start records a compile for user as running, s.mu must be held
+func (s *Scheduler) start(user string) {
+	s.turn++
+	s.turns[user] = s.turn
+	s.running[user]++
+	s.total++
+}
+
+// releaser returns a function freeing the process used by a compile for user, only the first call does anything
+func (s *Scheduler) releaser(user string) func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			s.running[user]--
+			if s.running[user] == 0 {
+				delete(s.running, user)
+
+				if len(s.queues[user]) == 0 {
+					delete(s.turns, user)
+				}
+			}
+			s.total--
+
+			s.dispatch()
+		})
+	}
+}
+
+/*
+dispatch starts waiting compiles while there are processes free. The user with the fewest compiles running goes next,
+ties going to whoever started a compile least recently and then to whoever has been waiting longest. s.mu must be held.
+*/
+func (s *Scheduler) dispatch() {
+	for s.total < s.capacity && s.waiting > 0 {
+		var next string
+		var head *waiter
+
+		for user, queue := range s.queues {
+			if head == nil || s.before(user, queue[0], next, head) {
+				next, head = user, queue[0]
+			}
+		}
+
+		if len(s.queues[next]) == 1 {
+			delete(s.queues, next)
+		} else {
+			s.queues[next] = s.queues[next][1:]
+		}
+		s.waiting--
+
+		s.start(next)
+		close(head.ready)
+	}
+}
+
+// before reports whether the compile w queued by user a should run before the compile v queued by user b
+func (s *Scheduler) before(a string, w *waiter, b string, v *waiter) bool {
+	if s.running[a] != s.running[b] {
+		return s.running[a] < s.running[b]
+	}
+
+	if s.turns[a] != s.turns[b] {
+		return s.turns[a] < s.turns[b]
+	}
+
+	return w.queued.Before(v.queued)
+}
+
+// SchedulerStats is a snapshot of the compiles running and waiting in a scheduler
+type SchedulerStats struct {
+	Capacity int `json:"capacity"`
+	Running  int `json:"running"`
+	Queued   int `json:"queued"`
+}
+
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SchedulerStats{
+		Capacity: s.capacity,
+		Running:  s.total,
+		Queued:   s.waiting,
+	}
+}
+
+var scheduler = NewScheduler(DefaultConcurrency)
+
+/*
+SetConcurrency sets how many compiler processes can run at once, it should be called before anything is compiled
+*/
+func SetConcurrency(n int) {
+	scheduler = NewScheduler(n)
+}
+
+// Stats reports the compiles currently running and waiting for a compiler process
+func Stats() SchedulerStats {
+	return scheduler.Stats()
+}
@@ -0,0 +1,127 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForQueued waits until n compiles are waiting in s
+func waitForQueued(t *testing.T, s *Scheduler, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for s.Stats().Queued != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d compiles to be queued, got %d", n, s.Stats().Queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler_LimitsConcurrency(t *testing.T) {
+	s := NewScheduler(2)
+
+	releaseA, stats, _ := s.Acquire(context.Background(), "a")
+	if stats.Depth != 0 || stats.Wait != 0 {
+		t.Errorf("Expected the first compile to start straight away, got %+v", stats)
+	}
+	releaseB, _, _ := s.Acquire(context.Background(), "b")
+
+	started := make(chan QueueStats)
+	go func() {
+		release, stats, _ := s.Acquire(context.Background(), "c")
+		defer release()
+		started <- stats
+	}()
+
+	waitForQueued(t, s, 1)
+	if got := s.Stats(); got.Running != 2 {
+		t.Errorf("Expected 2 compiles to be running, got %d", got.Running)
+	}
+
+	releaseA()
+	releaseA() // releasing twice must not free another process
+
+	stats = <-started
+	if stats.Depth != 0 || stats.Wait <= 0 {
+		t.Errorf("Expected the queued compile to report its wait, got %+v", stats)
+	}
+
+	releaseB()
+}
+
+func TestScheduler_SharesBetweenUsers(t *testing.T) {
+	s := NewScheduler(1)
+	release, _, _ := s.Acquire(context.Background(), "greedy")
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+
+	queue := func(user string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, _, _ := s.Acquire(context.Background(), user)
+
+			mu.Lock()
+			order = append(order, user)
+			mu.Unlock()
+
+			release()
+		}()
+	}
+
+	for i := 0; i < 3; i++ {
+		queue("greedy")
+		waitForQueued(t, s, i+1)
+	}
+	queue("other")
+	waitForQueued(t, s, 4)
+
+	release()
+	wg.Wait()
+
+	if len(order) != 4 || order[0] != "other" {
+		t.Errorf("Expected the other user to go before the greedy user's queue, got %v", order)
+	}
+}
+
+func TestScheduler_CancelWhileQueued(t *testing.T) {
+	s := NewScheduler(1)
+	release, _, _ := s.Acquire(context.Background(), "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error)
+	go func() {
+		_, _, err := s.Acquire(ctx, "b")
+		cancelled <- err
+	}()
+
+	waitForQueued(t, s, 1)
+	cancel()
+
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled compile to return the context's error, got %v", err)
+	}
+
+	if got := s.Stats(); got.Queued != 0 || got.Running != 1 {
+		t.Errorf("Expected the cancelled compile to leave the queue, got %+v", got)
+	}
+
+	release()
+
+	// the process freed by a must not have been handed to the cancelled compile
+	next, _, err := s.Acquire(context.Background(), "c")
+	if err != nil {
+		t.Fatalf("Expected the next compile to start, got %v", err)
+	}
+	next()
+
+	if got := s.Stats(); got.Running != 0 || got.Queued != 0 {
+		t.Errorf("Expected the scheduler to be idle, got %+v", got)
+	}
+}
@@ -0,0 +1,209 @@
+package wasm
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+// maxBuildTags is the most build tags a project can be built with
+const maxBuildTags = 16
+
+// buildTag matches a valid Go build tag
+var buildTag = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+// allowed lists the values which can be given for each build setting of a language, settings which aren't listed can't
+// be used with the language
+var allowed = map[model.ProjectLanguage]map[string][]string{
+	model.LanguageGo: {
+		"optimize":  {"0", "1", "2", "s", "z"},
+		"gc":        {"conservative", "leaking", "none", "precise"},
+		"scheduler": {"none", "asyncify", "coroutines"},
+		"panic":     {"print", "trap"},
+	},
+	model.LanguageAssemblyScript: {
+		"optimize": {"0", "1", "2", "3", "s", "z"},
+		"runtime":  {"incremental", "minimal", "stub"},
+	},
+}
+
+// versionRange is the versions of a compiler which accept a setting value, a bound which is empty isn't enforced
+type versionRange struct {
+	since string // since is the first version to accept the value
+	until string // until is the first version which no longer accepts the value
+}
+
+// versioned lists the allowed values of each setting of a language which only some versions of its compiler accept
+var versioned = map[model.ProjectLanguage]map[string]map[string]versionRange{
+	model.LanguageGo: {
+		"gc": {"precise": {since: "0.30.0"}},
+	},
+	model.LanguageAssemblyScript: {
+		"runtime": {"incremental": {since: "0.18.0"}, "minimal": {since: "0.18.0"}},
+	},
+}
+
+// SettingsError is returned when a project's build settings can't be used to compile it
+type SettingsError struct {
+	Setting string // Setting is the name of the setting which is invalid
+	msg     string
+}
+
+func (e *SettingsError) Error() string {
+	return e.msg
+}
+
+/*
+checkSetting makes sure value is allowed for a setting of language with version of its compiler, an empty value is
+always allowed
+*/
+func checkSetting(language model.ProjectLanguage, version, setting, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	values, ok := allowed[language][setting]
+	if !ok {
+		return &SettingsError{Setting: setting, msg: fmt.Sprintf("%s can't be set for %s projects", setting, language)}
+	}
+
+	for _, v := range values {
+		if v == value {
+			return checkSettingVersion(language, version, setting, value)
+		}
+	}
+
+	return &SettingsError{
+		Setting: setting,
+		msg:     fmt.Sprintf("%s must be one of %s, got %q", setting, strings.Join(values, ", "), value),
+	}
+}
+
+// checkSettingVersion makes sure version of the compiler for language accepts value for a setting
+func checkSettingVersion(language model.ProjectLanguage, version, setting, value string) error {
+	r, ok := versioned[language][setting][value]
+	if !ok || version == "" {
+		return nil
+	}
+
+	tool := compilers[language]
+
+	if r.since != "" && compareVersions(version, r.since) < 0 {
+		return &SettingsError{
+			Setting: setting,
+			msg:     fmt.Sprintf("%s %s needs %s %s or later, the project uses %s", setting, value, tool, r.since, version),
+		}
+	}
+
+	if r.until != "" && compareVersions(version, r.until) >= 0 {
+		return &SettingsError{
+			Setting: setting,
+			msg:     fmt.Sprintf("%s %s isn't supported from %s %s, the project uses %s", setting, value, tool, r.until, version),
+		}
+	}
+
+	return nil
+}
+
+/*
+ValidateSettings makes sure a project in language can be compiled with the given build settings by version of its
+compiler. Values which only some versions of the compiler accept are allowed when version is empty.
+*/
+func ValidateSettings(language model.ProjectLanguage, version string, s model.BuildSettings) error {
+	if _, ok := allowed[language]; !ok {
+		return &SettingsError{msg: "unknown language"}
+	}
+
+	checks := []struct{ setting, value string }{
+		{"optimize", s.Optimize},
+		{"gc", s.GC},
+		{"scheduler", s.Scheduler},
+		{"panic", s.Panic},
+		{"runtime", s.Runtime},
+	}
+
+	for _, c := range checks {
+		if err := checkSetting(language, version, c.setting, c.value); err != nil {
+			return err
+		}
+	}
+
+	if s.ExportRuntime && language != model.LanguageAssemblyScript {
+		return &SettingsError{Setting: "export_runtime", msg: fmt.Sprintf("export_runtime can't be set for %s projects", language)}
+	}
+
+	if len(s.Tags) > 0 && language != model.LanguageGo {
+		return &SettingsError{Setting: "tags", msg: fmt.Sprintf("tags can't be set for %s projects", language)}
+	}
+
+	if len(s.Tags) > maxBuildTags {
+		return &SettingsError{Setting: "tags", msg: fmt.Sprintf("a project can have at most %d build tags", maxBuildTags)}
+	}
+
+	for _, tag := range s.Tags {
+		if !buildTag.MatchString(tag) {
+			return &SettingsError{Setting: "tags", msg: fmt.Sprintf("%q is not a valid build tag", tag)}
+		}
+	}
+
+	return nil
+}
+
+// tinygoFlags returns the flags passed to tinygo build for a project's build settings
+func tinygoFlags(s model.BuildSettings) []string {
+	var flags []string
+
+	if s.Optimize != "" {
+		flags = append(flags, "-opt", s.Optimize)
+	}
+
+	if s.Debug != nil && !*s.Debug {
+		flags = append(flags, "-no-debug")
+	}
+
+	if s.GC != "" {
+		flags = append(flags, "-gc", s.GC)
+	}
+
+	if s.Scheduler != "" {
+		flags = append(flags, "-scheduler", s.Scheduler)
+	}
+
+	if s.Panic != "" {
+		flags = append(flags, "-panic", s.Panic)
+	}
+
+	if len(s.Tags) > 0 {
+		tags := append([]string{}, s.Tags...)
+		sort.Strings(tags)
+		flags = append(flags, "-tags", strings.Join(tags, " "))
+	}
+
+	return flags
+}
+
+// ascFlags returns the flags passed to asc for a project's build settings
+func ascFlags(s model.BuildSettings) []string {
+	var flags []string
+
+	if s.Optimize != "" {
+		flags = append(flags, "-O"+s.Optimize)
+	}
+
+	if s.Debug != nil && *s.Debug {
+		flags = append(flags, "--debug")
+	}
+
+	if s.Runtime != "" {
+		flags = append(flags, "--runtime", s.Runtime)
+	}
+
+	if s.ExportRuntime {
+		flags = append(flags, "--exportRuntime")
+	}
+
+	return flags
+}
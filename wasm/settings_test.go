@@ -0,0 +1,101 @@
+package wasm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestValidateSettings(t *testing.T) {
+	debug := false
+
+	valid := []struct {
+		language model.ProjectLanguage
+		settings model.BuildSettings
+	}{
+		{model.LanguageGo, model.BuildSettings{}},
+		{model.LanguageGo, model.BuildSettings{Optimize: "z", Debug: &debug, GC: "leaking", Scheduler: "none", Panic: "trap", Tags: []string{"purego", "v1.2"}}},
+		{model.LanguageAssemblyScript, model.BuildSettings{Optimize: "3", Debug: &debug, Runtime: "stub", ExportRuntime: true}},
+	}
+
+	for _, v := range valid {
+		if err := ValidateSettings(v.language, "", v.settings); err != nil {
+			t.Errorf("Expected %+v to be valid for %s, got %v", v.settings, v.language, err)
+		}
+	}
+
+	invalid := []struct {
+		language model.ProjectLanguage
+		settings model.BuildSettings
+		setting  string
+	}{
+		{model.LanguageGo, model.BuildSettings{Optimize: "3"}, "optimize"},
+		{model.LanguageGo, model.BuildSettings{GC: "-o /etc/passwd"}, "gc"},
+		{model.LanguageGo, model.BuildSettings{Runtime: "stub"}, "runtime"},
+		{model.LanguageGo, model.BuildSettings{ExportRuntime: true}, "export_runtime"},
+		{model.LanguageGo, model.BuildSettings{Tags: []string{"a b"}}, "tags"},
+		{model.LanguageAssemblyScript, model.BuildSettings{Scheduler: "asyncify"}, "scheduler"},
+		{model.LanguageAssemblyScript, model.BuildSettings{Tags: []string{"purego"}}, "tags"},
+	}
+
+	for _, v := range invalid {
+		err := ValidateSettings(v.language, "", v.settings)
+
+		settingsErr, ok := err.(*SettingsError)
+		if !ok || settingsErr.Setting != v.setting {
+			t.Errorf("Expected %+v to have an invalid %s for %s, got %v", v.settings, v.setting, v.language, err)
+		}
+	}
+}
+
+func TestValidateSettings_Version(t *testing.T) {
+	tests := []struct {
+		language model.ProjectLanguage
+		version  string
+		settings model.BuildSettings
+		valid    bool
+	}{
+		{model.LanguageGo, "0.30.0", model.BuildSettings{GC: "precise"}, true},
+		{model.LanguageGo, "0.26.0", model.BuildSettings{GC: "precise"}, false},
+		{model.LanguageGo, "0.30.0-dev", model.BuildSettings{GC: "precise"}, false},
+		{model.LanguageGo, "0.26.0", model.BuildSettings{GC: "leaking"}, true},
+		{model.LanguageAssemblyScript, "0.17.14", model.BuildSettings{Runtime: "incremental"}, false},
+		{model.LanguageAssemblyScript, "0.17.14", model.BuildSettings{Runtime: "stub"}, true},
+		{model.LanguageAssemblyScript, "0.27.1", model.BuildSettings{Runtime: "minimal"}, true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateSettings(tt.language, tt.version, tt.settings)
+
+		if tt.valid && err != nil {
+			t.Errorf("Expected %+v to be valid for %s %s, got %v", tt.settings, tt.language, tt.version, err)
+		}
+
+		if _, ok := err.(*SettingsError); !tt.valid && !ok {
+			t.Errorf("Expected %+v to be invalid for %s %s, got %v", tt.settings, tt.language, tt.version, err)
+		}
+	}
+}
+
+func TestSettingsFlags(t *testing.T) {
+	debug := false
+	settings := model.BuildSettings{Optimize: "s", Debug: &debug, GC: "leaking", Panic: "trap", Tags: []string{"b", "a"}}
+
+	want := []string{"-opt", "s", "-no-debug", "-gc", "leaking", "-panic", "trap", "-tags", "a b"}
+	if got := tinygoFlags(settings); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected tinygo flags %v, got %v", want, got)
+	}
+
+	debug = true
+	settings = model.BuildSettings{Optimize: "3", Debug: &debug, Runtime: "minimal", ExportRuntime: true}
+
+	want = []string{"-O3", "--debug", "--runtime", "minimal", "--exportRuntime"}
+	if got := ascFlags(settings); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected asc flags %v, got %v", want, got)
+	}
+
+	if got := tinygoFlags(model.BuildSettings{}); len(got) != 0 {
+		t.Errorf("Expected the default settings to add no flags, got %v", got)
+	}
+}
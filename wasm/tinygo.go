@@ -1,46 +1,69 @@
 package wasm
 
 import (
-	"bytes"
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path"
-	"strings"
+
+	"github.com/sammyhass/web-ide/server/model"
 )
 
 /*
 compileTinyGo takes a string of Go code  and compiles it to WASM
 */
 func compileTinyGo(code string, opts CompileOpts) (CompileResult, error) {
+	return compileTinyGoFiles(context.Background(), onPath("tinygo"), model.ProjectFiles{"main.go": code}, opts)
+}
+
+// goModule is the module path given to projects without their own go.mod, packages in a subdirectory of the project are
+// imported as goModule/<dir>
+const goModule = "project"
+
+// withGoModule returns the files of a project along with a go.mod declaring goModule if the project doesn't have one
+func withGoModule(files model.ProjectFiles) model.ProjectFiles {
+	if _, ok := files["go.mod"]; ok {
+		return files
+	}
+
+	withMod := make(model.ProjectFiles, len(files)+1)
+	for p, content := range files {
+		withMod[p] = content
+	}
+	withMod["go.mod"] = fmt.Sprintf("module %s\n\ngo 1.19\n", goModule)
+
+	return withMod
+}
+
+/*
+compileTinyGoFiles compiles the main package at the root of a project to WASM, building every file in the package along
+with the packages it imports from the rest of the project, using the given version of TinyGo
+*/
+func compileTinyGoFiles(
+	ctx context.Context,
+	compiler installation,
+	files model.ProjectFiles,
+	opts CompileOpts,
+) (CompileResult, error) {
 	result := CompileResult{}
 
-	dir, deleteDir, err := createTempCodeDir("main.go", code)
+	dir, deleteDir, err := createTempCodeDir(withGoModule(files))
 	if err != nil {
 		return result, err
 	}
 	defer deleteDir()
 
-	filename := "main.go"
 	out := "main.wasm"
 
-	cmd := exec.Command("tinygo", "build", "-o", out, "-target", "wasm", filename)
-	cmd.Dir = dir
-
-	stderr := bytes.Buffer{}
-	cmd.Stderr = &stderr
+	args := append([]string{"build", "-o", out, "-target", "wasm"}, tinygoFlags(opts.Settings)...)
+	args = append(args, ".")
 
-	fmt.Println("Compiling TinyGo code...")
-
-	errs := []string{}
-	if err := cmd.Run(); err != nil {
-
-		errs = append(errs, strings.Split(stderr.String(), "\n")...)
-		fmt.Println(errs)
-
-		return result, errors.New(strings.Join(errs, "\n"))
+	stderr, err := runCompilerWithEnv(ctx, dir, opts.Output, compiler.env(), compiler.binary, args...)
+	if err != nil {
+		return result, compilerError(err, stderr, func(output string) []model.Diagnostic {
+			return parseGoDiagnostics(output, dir)
+		})
 	}
 
 	f, err := os.Open(path.Join(dir, out))
@@ -63,7 +86,7 @@ func compileTinyGo(code string, opts CompileOpts) (CompileResult, error) {
 
 	result.Wasm = wasmBytes
 	if opts.GenWat {
-		wat, err := WasmToWat(bytes.NewReader(wasmBytes))
+		wat, err := wasmFileToWat(ctx, dir, out, opts.Output)
 		if err != nil {
 			return result, err
 		}
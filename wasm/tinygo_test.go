@@ -1,8 +1,12 @@
 package wasm
 
 import (
+	"context"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
 )
 
 var src = `package main
@@ -156,3 +160,48 @@ func TestCompile_BeforeDelete(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestWithGoModule(t *testing.T) {
+	files := model.ProjectFiles{"main.go": "package main"}
+
+	withMod := withGoModule(files)
+	if !strings.HasPrefix(withMod["go.mod"], "module "+goModule+"\n") {
+		t.Errorf("Expected a go.mod declaring %s, got '%s'", goModule, withMod["go.mod"])
+	}
+
+	if _, ok := files["go.mod"]; ok {
+		t.Error("Expected the original files to be left unchanged")
+	}
+
+	own := model.ProjectFiles{"main.go": "package main", "go.mod": "module example.com/app\n"}
+	if withGoModule(own)["go.mod"] != own["go.mod"] {
+		t.Error("Expected a project's own go.mod to be kept")
+	}
+}
+
+func TestCompile_BuildsWholePackage(t *testing.T) {
+	files := model.ProjectFiles{
+		"main.go": `package main
+
+import "project/lib"
+
+func main() {
+	println(greeting(), lib.Add(1, 2))
+}`,
+		"greeting.go": `package main
+
+func greeting() string { return "hello" }`,
+		"lib/math.go": `package lib
+
+func Add(a, b int) int { return a + b }`,
+	}
+
+	res, err := compileTinyGoFiles(context.Background(), onPath("tinygo"), files, CompileOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Wasm) == 0 {
+		t.Error("Expected wasm to be non-empty")
+	}
+}
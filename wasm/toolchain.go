@@ -0,0 +1,492 @@
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+const (
+	// versionTimeout is the longest a tool is given to report its version
+	versionTimeout = 10 * time.Second
+	// versionTTL is how long a tool's version is remembered, so that installing or upgrading a tool is noticed without
+	// a restart
+	versionTTL = time.Minute
+)
+
+// versionArgs are the arguments which make each of the tools used to compile projects report its version
+var versionArgs = map[string][]string{
+	"tinygo":   {"version"},
+	"asc":      {"--version"},
+	"wasm2wat": {"--version"},
+}
+
+// compilers maps each language to the tool which compiles it
+var compilers = map[model.ProjectLanguage]string{
+	model.LanguageGo:             "tinygo",
+	model.LanguageAssemblyScript: "asc",
+}
+
+// languages are the languages projects can be written in, in the order they are listed
+var languages = []model.ProjectLanguage{model.LanguageGo, model.LanguageAssemblyScript}
+
+// versionNumber matches the version number in what a tool reports as its version, such as 0.26.0
+var versionNumber = regexp.MustCompile(`\d+\.\d+\.\d+[0-9A-Za-z.+-]*`)
+
+var (
+	toolchainsMu sync.RWMutex
+	// toolchainsDir holds versions of the compilers installed side by side, see SetToolchainsDir
+	toolchainsDir string
+	// defaultVersions are the versions new projects in each language are pinned to, see SetDefaultVersion
+	defaultVersions = make(map[model.ProjectLanguage]string)
+)
+
+/*
+SetToolchainsDir sets the directory holding the versions of the compilers which can be used, each installed in
+<dir>/<tool>/<version> with its executable in the bin directory, such as <dir>/tinygo/0.26.0/bin/tinygo. The compiler
+on PATH can be used as well, known by the version it reports.
+*/
+func SetToolchainsDir(dir string) {
+	toolchainsMu.Lock()
+	defer toolchainsMu.Unlock()
+
+	toolchainsDir = dir
+}
+
+// SetDefaultVersion sets the version of its compiler new projects in language are pinned to, when version is empty the
+// newest installed version is used
+func SetDefaultVersion(language model.ProjectLanguage, version string) {
+	toolchainsMu.Lock()
+	defer toolchainsMu.Unlock()
+
+	defaultVersions[language] = version
+}
+
+// installation is one installed version of a tool
+type installation struct {
+	tool    string
+	version string // version is the version number projects are pinned to
+	binary  string // binary is the path of the executable, or its name when it is run from PATH
+	root    string // root is the directory a version in the toolchains directory is installed in, empty for the tool on PATH
+}
+
+// onPath is the version of tool found on PATH
+func onPath(tool string) installation {
+	return installation{tool: tool, binary: tool}
+}
+
+// String names the installation in the same way as the toolchain recorded on a compile, such as tinygo 0.26.0
+func (i installation) String() string {
+	return fmt.Sprintf("%s %s", i.tool, i.version)
+}
+
+/*
+env returns the environment variables a version in the toolchains directory is run with, which put its executables
+first on PATH and, for TinyGo, point it at its own standard library rather than that of the TinyGo on PATH
+*/
+func (i installation) env() []string {
+	if i.root == "" {
+		return nil
+	}
+
+	env := []string{"PATH=" + filepath.Join(i.root, "bin") + string(os.PathListSeparator) + os.Getenv("PATH")}
+	if i.tool == "tinygo" {
+		env = append(env, "TINYGOROOT="+i.root)
+	}
+
+	return env
+}
+
+type toolVersion struct {
+	version string
+	err     error
+	checked time.Time
+}
+
+var (
+	versionsMu sync.Mutex
+	versions   = make(map[string]toolVersion)
+)
+
+/*
+toolVersionOf returns the version reported by an installed tool. Tools which are missing are remembered for as long as
+those which aren't so that checking for them is cheap.
+*/
+func toolVersionOf(inst installation) (string, error) {
+	versionsMu.Lock()
+	v, ok := versions[inst.binary]
+	versionsMu.Unlock()
+
+	if ok && time.Since(v.checked) < versionTTL {
+		return v.version, v.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	v = toolVersion{checked: time.Now()}
+
+	cmd := exec.CommandContext(ctx, inst.binary, versionArgs[inst.tool]...)
+	if extra := inst.env(); extra != nil {
+		cmd.Env = setEnv(os.Environ(), extra...)
+	}
+
+	out, err := cmd.Output()
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		v.err = fmt.Errorf("%s is not installed", inst.tool)
+	case err != nil:
+		v.err = fmt.Errorf("%s could not report its version: %w", inst.tool, err)
+	default:
+		v.version = strings.TrimSpace(string(out))
+	}
+
+	versionsMu.Lock()
+	versions[inst.binary] = v
+	versionsMu.Unlock()
+
+	return v.version, v.err
+}
+
+/*
+compareVersions orders two version numbers, returning a negative number when a is older than b and a positive number
+when it is newer. A pre-release is older than the release it comes before.
+*/
+func compareVersions(a, b string) int {
+	aRelease, aPre, _ := strings.Cut(a, "-")
+	bRelease, bPre, _ := strings.Cut(b, "-")
+
+	as, bs := strings.Split(aRelease, "."), strings.Split(bRelease, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, xErr := strconv.Atoi(as[i])
+		y, yErr := strconv.Atoi(bs[i])
+
+		if xErr != nil || yErr != nil {
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		} else if x != y {
+			return x - y
+		}
+	}
+
+	if len(as) != len(bs) {
+		return len(as) - len(bs)
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+
+	return strings.Compare(aPre, bPre)
+}
+
+// installationsOf finds each installed version of tool, newest first
+func installationsOf(tool string) []installation {
+	toolchainsMu.RLock()
+	dir := toolchainsDir
+	toolchainsMu.RUnlock()
+
+	var found []installation
+	seen := make(map[string]bool)
+
+	if dir != "" {
+		entries, _ := os.ReadDir(filepath.Join(dir, tool))
+		for _, entry := range entries {
+			root := filepath.Join(dir, tool, entry.Name())
+			binary := filepath.Join(root, "bin", tool)
+
+			if info, err := os.Stat(binary); err != nil || info.IsDir() {
+				continue
+			}
+
+			found = append(found, installation{tool: tool, version: entry.Name(), binary: binary, root: root})
+			seen[entry.Name()] = true
+		}
+	}
+
+	// the tool on PATH is known by the version it reports, unless the same version is in the toolchains directory
+	path := onPath(tool)
+	if out, err := toolVersionOf(path); err == nil {
+		if v := versionNumber.FindString(out); v != "" && !seen[v] {
+			path.version = v
+			found = append(found, path)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return compareVersions(found[i].version, found[j].version) > 0
+	})
+
+	return found
+}
+
+/*
+DefaultVersion returns the version of its compiler new projects in language are pinned to, which is the version set by
+SetDefaultVersion or otherwise the newest installed version. It is empty when no version of the compiler is installed.
+*/
+func DefaultVersion(language model.ProjectLanguage) string {
+	toolchainsMu.RLock()
+	version := defaultVersions[language]
+	toolchainsMu.RUnlock()
+
+	if version != "" {
+		return version
+	}
+
+	if installed := installationsOf(compilers[language]); len(installed) > 0 {
+		return installed[0].version
+	}
+
+	return ""
+}
+
+// UnavailableError is returned when a project can't be compiled because its toolchain isn't installed
+type UnavailableError struct {
+	Language string
+	Version  string // Version is the version of the compiler which was asked for, empty when none is installed
+	msg      string
+}
+
+func (e *UnavailableError) Error() string {
+	return e.msg
+}
+
+/*
+resolve finds the installed version of the compiler for language, version is the version a project is pinned to or
+empty for the default version
+*/
+func resolve(language model.ProjectLanguage, version string) (installation, error) {
+	tool, ok := compilers[language]
+	if !ok {
+		return installation{}, errors.New("unknown language")
+	}
+
+	pinned := version != ""
+	if !pinned {
+		version = DefaultVersion(language)
+	}
+
+	if version == "" {
+		// nothing is installed, which is explained by the error from the tool on PATH
+		reason := fmt.Sprintf("the version of %s could not be found", tool)
+		if _, err := toolVersionOf(onPath(tool)); err != nil {
+			reason = err.Error()
+		}
+
+		return installation{}, &UnavailableError{
+			Language: language.String(),
+			msg:      fmt.Sprintf("%s projects can't be compiled right now: %s", language, reason),
+		}
+	}
+
+	for _, inst := range installationsOf(tool) {
+		if inst.version == version {
+			return inst, nil
+		}
+	}
+
+	msg := fmt.Sprintf("%s %s is not installed, upgrade the project to an installed version", tool, version)
+	if !pinned {
+		msg = fmt.Sprintf("%s projects can't be compiled right now: the default %s %s is not installed", language, tool, version)
+	}
+
+	return installation{}, &UnavailableError{Language: language.String(), Version: version, msg: msg}
+}
+
+/*
+checkToolchain makes sure every tool needed to compile a project in language with version of its compiler is installed,
+returning the compiler
+*/
+func checkToolchain(language model.ProjectLanguage, version string) (installation, error) {
+	if sandboxRequired && !Isolated() {
+		return installation{}, &UnavailableError{
+			Language: language.String(),
+			Version:  version,
+			msg:      fmt.Sprintf("%s projects can't be compiled right now: %s", language, errNotIsolated),
+		}
+	}
+
+	compiler, err := resolve(language, version)
+	if err != nil {
+		return installation{}, err
+	}
+
+	for _, inst := range []installation{compiler, onPath("wasm2wat")} {
+		if _, err := toolVersionOf(inst); err != nil {
+			return installation{}, &UnavailableError{
+				Language: language.String(),
+				Version:  version,
+				msg:      fmt.Sprintf("%s projects can't be compiled right now: %s", language, err),
+			}
+		}
+	}
+
+	return compiler, nil
+}
+
+/*
+CheckToolchain makes sure every tool needed to compile projects in language is installed, version is the version of the
+compiler a project is pinned to or empty for the default version
+*/
+func CheckToolchain(language model.ProjectLanguage, version string) error {
+	_, err := checkToolchain(language, version)
+	return err
+}
+
+// Tool describes one installed version of the tools used to compile projects
+type Tool struct {
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`     // Version is the version number projects are pinned to
+	Description string `json:"description,omitempty"` // Description is everything the tool reports as its version
+	Available   bool   `json:"available"`
+	Default     bool   `json:"default,omitempty"` // Default is whether new projects are pinned to this version
+	Error       string `json:"error,omitempty"`   // Error is why a tool which isn't available can't be used
+}
+
+// Toolchain describes whether projects in a language can be compiled and the tools they are compiled with
+type Toolchain struct {
+	Language  string `json:"language"`
+	Available bool   `json:"available"`
+	Default   string `json:"default,omitempty"` // Default is the version of the compiler new projects are pinned to
+	Error     string `json:"error,omitempty"`   // Error is why projects which use the default version can't be compiled
+	Tools     []Tool `json:"tools"`
+}
+
+// toolOf checks one installed version of a tool
+func toolOf(inst installation) Tool {
+	tool := Tool{Name: inst.tool, Version: inst.version}
+
+	description, err := toolVersionOf(inst)
+	if err != nil {
+		tool.Error = err.Error()
+		return tool
+	}
+
+	tool.Description = description
+	tool.Available = true
+	if tool.Version == "" {
+		tool.Version = versionNumber.FindString(description)
+	}
+
+	return tool
+}
+
+// toolchainOf checks each installed version of the compiler for language along with wasm2wat
+func toolchainOf(language model.ProjectLanguage) Toolchain {
+	tc := Toolchain{Language: language.String(), Default: DefaultVersion(language)}
+
+	if err := CheckToolchain(language, ""); err != nil {
+		tc.Error = err.Error()
+	} else {
+		tc.Available = true
+	}
+
+	compiler := compilers[language]
+	installed := installationsOf(compiler)
+	if len(installed) == 0 {
+		installed = []installation{onPath(compiler)}
+	}
+
+	for _, inst := range installed {
+		tool := toolOf(inst)
+		tool.Default = inst.version != "" && inst.version == tc.Default
+
+		tc.Tools = append(tc.Tools, tool)
+	}
+
+	tc.Tools = append(tc.Tools, toolOf(onPath("wasm2wat")))
+
+	return tc
+}
+
+// Toolchains checks the tools used to compile each language, listing the languages which can't be compiled as unavailable
+func Toolchains() []Toolchain {
+	toolchains := make([]Toolchain, len(languages))
+	for i, language := range languages {
+		toolchains[i] = toolchainOf(language)
+	}
+
+	return toolchains
+}
+
+/*
+ToolchainVersion describes the versions of the tools used to compile a project in language with version of its
+compiler, including wasm2wat when WAT is generated
+*/
+func ToolchainVersion(language model.ProjectLanguage, version string, genWat bool) (string, error) {
+	compiler, err := resolve(language, version)
+	if err != nil {
+		return "", err
+	}
+
+	tools := []installation{compiler}
+	if genWat {
+		tools = append(tools, onPath("wasm2wat"))
+	}
+
+	versions := make([]string, len(tools))
+	for i, tool := range tools {
+		v, err := toolVersionOf(tool)
+		if err != nil {
+			return "", err
+		}
+		versions[i] = fmt.Sprintf("%s %s", tool.tool, v)
+	}
+
+	return strings.Join(versions, "\n"), nil
+}
+
+/*
+buildKey hashes everything which decides the output of a compile, which is the project's files, language, the options
+which change the artifacts, including the build settings, and the version of the toolchain
+*/
+func buildKey(language model.ProjectLanguage, files model.ProjectFiles, opts CompileOpts, toolchain string) string {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "language %s\nwat %t\ntoolchain %q\n", language, opts.GenWat, toolchain)
+	fmt.Fprintf(h, "flags %q %q\n", tinygoFlags(opts.Settings), ascFlags(opts.Settings))
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		fmt.Fprintf(h, "file %q %s\n", p, model.HashContent(files[p]))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+/*
+BuildKey returns the key of the artifacts a compile of files in language would produce, compiles with the same key
+produce the same artifacts so can be cached. It fails if the version of the toolchain can't be found.
+*/
+func BuildKey(language model.ProjectLanguage, files model.ProjectFiles, opts CompileOpts) (string, error) {
+	toolchain, err := ToolchainVersion(language, opts.Version, opts.GenWat)
+	if err != nil {
+		return "", err
+	}
+
+	return buildKey(language, files, opts, toolchain), nil
+}
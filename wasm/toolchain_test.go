@@ -0,0 +1,149 @@
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sammyhass/web-ide/server/model"
+)
+
+func TestBuildKey(t *testing.T) {
+	files := model.ProjectFiles{"main.go": "package main", "lib/lib.go": "package lib"}
+	opts := CompileOpts{GenWat: true}
+
+	key := buildKey(model.LanguageGo, files, opts, "tinygo 0.26.0")
+
+	same := model.ProjectFiles{"lib/lib.go": "package lib", "main.go": "package main"}
+	if got := buildKey(model.LanguageGo, same, CompileOpts{GenWat: true, User: "someone else"}, "tinygo 0.26.0"); got != key {
+		t.Error("Expected the same files and options to have the same key")
+	}
+
+	changes := map[string]string{
+		"content":   buildKey(model.LanguageGo, model.ProjectFiles{"main.go": "package main", "lib/lib.go": "package lib2"}, opts, "tinygo 0.26.0"),
+		"path":      buildKey(model.LanguageGo, model.ProjectFiles{"main.go": "package main", "lib/lib2.go": "package lib"}, opts, "tinygo 0.26.0"),
+		"language":  buildKey(model.LanguageAssemblyScript, files, opts, "tinygo 0.26.0"),
+		"options":   buildKey(model.LanguageGo, files, CompileOpts{}, "tinygo 0.26.0"),
+		"toolchain": buildKey(model.LanguageGo, files, opts, "tinygo 0.27.0"),
+	}
+
+	for change, got := range changes {
+		if got == key {
+			t.Errorf("Expected changing the %s to change the key", change)
+		}
+	}
+}
+
+// fakeTool installs a script at path which reports version when asked for its version
+func fakeTool(t *testing.T, path, version string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := fmt.Sprintf("#!/bin/sh\necho fake version %s\n", version)
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToolVersionOf(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "fake-compiler")
+	fakeTool(t, binary, "1.2.3")
+
+	v, err := toolVersionOf(installation{tool: "fake-compiler", binary: binary})
+	if err != nil || v != "fake version 1.2.3" {
+		t.Errorf("Expected version 'fake version 1.2.3', got '%s' (%v)", v, err)
+	}
+
+	if _, err := toolVersionOf(onPath("missing-compiler")); err == nil || err.Error() != "missing-compiler is not installed" {
+		t.Errorf("Expected the compiler to be reported as not installed, got %v", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"0.9.0", "0.10.0-rc1", "0.10.0", "0.10.1", "1.0.0"}
+
+	for i := range ordered {
+		for j := range ordered {
+			got := compareVersions(ordered[i], ordered[j])
+			if (i < j && got >= 0) || (i > j && got <= 0) || (i == j && got != 0) {
+				t.Errorf("Expected %s and %s to be ordered by their position, got %d", ordered[i], ordered[j], got)
+			}
+		}
+	}
+}
+
+// withToolchains installs fake versions of the Go compiler in a toolchains directory for the length of a test
+func withToolchains(t *testing.T, versions ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, v := range versions {
+		fakeTool(t, filepath.Join(dir, "fake-tinygo", v, "bin", "fake-tinygo"), v)
+	}
+
+	// a version which was only partly installed is ignored
+	if err := os.MkdirAll(filepath.Join(dir, "fake-tinygo", "9.9.9"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	compilers[model.LanguageGo] = "fake-tinygo"
+	SetToolchainsDir(dir)
+	t.Cleanup(func() {
+		compilers[model.LanguageGo] = "tinygo"
+		SetToolchainsDir("")
+		SetDefaultVersion(model.LanguageGo, "")
+	})
+
+	return dir
+}
+
+func TestInstallationsOf(t *testing.T) {
+	dir := withToolchains(t, "0.9.0", "0.26.0", "0.10.0")
+
+	installed := installationsOf("fake-tinygo")
+
+	var got []string
+	for _, inst := range installed {
+		got = append(got, inst.version)
+	}
+
+	if strings.Join(got, " ") != "0.26.0 0.10.0 0.9.0" {
+		t.Fatalf("Expected the installed versions newest first, got %v", got)
+	}
+
+	root := filepath.Join(dir, "fake-tinygo", "0.26.0")
+	if installed[0].root != root || installed[0].binary != filepath.Join(root, "bin", "fake-tinygo") {
+		t.Errorf("Expected 0.26.0 to be run from %s, got %+v", root, installed[0])
+	}
+}
+
+func TestResolve(t *testing.T) {
+	withToolchains(t, "0.9.0", "0.26.0")
+
+	if v := DefaultVersion(model.LanguageGo); v != "0.26.0" {
+		t.Errorf("Expected the newest version to be the default, got %s", v)
+	}
+
+	inst, err := resolve(model.LanguageGo, "0.9.0")
+	if err != nil || inst.version != "0.9.0" {
+		t.Errorf("Expected the pinned version to be used, got %+v (%v)", inst, err)
+	}
+
+	SetDefaultVersion(model.LanguageGo, "0.9.0")
+	if inst, err := resolve(model.LanguageGo, ""); err != nil || inst.version != "0.9.0" {
+		t.Errorf("Expected projects without a version to use the default, got %+v (%v)", inst, err)
+	}
+
+	_, err = resolve(model.LanguageGo, "0.25.0")
+
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) || unavailable.Version != "0.25.0" {
+		t.Errorf("Expected a version which isn't installed to be unavailable, got %v", err)
+	}
+}
@@ -1,36 +1,53 @@
 package wasm
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 // Convert a WASM reader to a WebAssembly Text Format (WAT) string
 func WasmToWat(wasmReader io.Reader) (string, error) {
-	f, err := os.CreateTemp("", "wasm2wat-*.wasm")
+	dir, err := os.MkdirTemp("", "wasm2wat-*")
 	if err != nil {
 		return "", err
 	}
-	defer os.Remove(f.Name())
+	defer os.RemoveAll(dir)
 
-	_, err = io.Copy(f, wasmReader)
+	f, err := os.Create(filepath.Join(dir, "main.wasm"))
 	if err != nil {
 		return "", err
 	}
 
-	watF, err := os.CreateTemp("", "wasm2wat-*.wat")
+	_, err = io.Copy(f, wasmReader)
+	f.Close()
 	if err != nil {
 		return "", err
 	}
 
-	cmd := exec.Command("wasm2wat", "--enable-all", f.Name(), "-o", watF.Name())
+	return wasmFileToWat(context.Background(), dir, "main.wasm", nil)
+}
+
+/*
+wasmFileToWat converts the WASM file name in dir to WAT, the conversion runs in the sandbox with dir as its scratch dir
+and anything it writes is passed to output
+*/
+func wasmFileToWat(ctx context.Context, dir, name string, output OutputFunc) (string, error) {
+	out := name + ".wat"
 
-	if err := cmd.Run(); err != nil {
+	stderr, err := runCompiler(ctx, dir, output, "wasm2wat", "--enable-all", name, "-o", out)
+	if err == errCompilerFailed {
+		return "", fmt.Errorf("wasm2wat failed: %s", strings.TrimSpace(stderr))
+	}
+
+	if err != nil {
 		return "", err
 	}
 
-	watBytes, err := io.ReadAll(watF)
+	watBytes, err := os.ReadFile(filepath.Join(dir, out))
 	if err != nil {
 		return "", err
 	}